@@ -13,7 +13,7 @@ import (
 func CalculateRemap() *cli.Command { //nolint
 	return &cli.Command{
 		Name:   binary.CalculateRemapCommand,
-		Usage:  "remap resource",
+		Usage:  "recompute the engine params of workloads holding devices, the devices are kept",
 		Action: calculateRemap,
 	}
 }
@@ -30,7 +30,6 @@ func calculateRemap(c *cli.Context) error {
 			workloadsResource[ID] = resourcetypes.RawParams{}
 			_ = mapstructure.Decode(data, workloadsResource[ID])
 		}
-		// NO NEED REMAP GPU
 		return s.CalculateRemap(c.Context, nodename, workloadsResource)
 	})
 }
@@ -4,12 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"testing"
 
 	resourcetypes "github.com/projecteru2/core/resource/types"
 	"github.com/projecteru2/core/utils"
 	"github.com/urfave/cli/v2"
 	"github.com/yuyang0/resource-gpu/gpu"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 )
 
 var (
@@ -17,18 +17,33 @@ var (
 	EmbeddedStorage bool
 )
 
-func Serve(c *cli.Context, f func(s *gpu.Plugin, in resourcetypes.RawParams) (interface{}, error)) error {
+// NewPlugin creates the plugin by the config file and flags
+func NewPlugin(c *cli.Context) (*gpu.Plugin, error) {
 	config, err := utils.LoadConfig(ConfigPath)
 	if err != nil {
-		return cli.Exit(err, 128)
+		return nil, err
 	}
+	gpuConfig, err := LoadGPUConfig()
+	if err != nil {
+		return nil, err
+	}
+	return gpu.NewPlugin(c.Context, config, gpuConfig)
+}
 
-	var t *testing.T
+// LoadGPUConfig loads the config of plugin by the config file and flags
+func LoadGPUConfig() (*gputypes.Config, error) {
+	gpuConfig, err := gputypes.LoadConfig(ConfigPath)
+	if err != nil {
+		return nil, err
+	}
 	if EmbeddedStorage {
-		t = &testing.T{}
+		gpuConfig.Storage = gputypes.StorageConfig{Type: gputypes.StorageMemory}
 	}
+	return gpuConfig, nil
+}
 
-	s, err := gpu.NewPlugin(c.Context, config, t)
+func Serve(c *cli.Context, f func(s *gpu.Plugin, in resourcetypes.RawParams) (interface{}, error)) error {
+	s, err := NewPlugin(c)
 	if err != nil {
 		return cli.Exit(err, 128)
 	}
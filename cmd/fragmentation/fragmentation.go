@@ -0,0 +1,38 @@
+package fragmentation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+)
+
+func Fragmentation() *cli.Command {
+	return &cli.Command{
+		Name:   "fragmentation",
+		Usage:  "analyze the fragmentation of GPUs per product and plan the migrations to free whole nodes",
+		Action: analyzeFragmentation,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "nodes", Usage: "the nodes to analyze, all the nodes by default"},
+			&cli.IntSliceFlag{Name: "sizes", Usage: "the numbers of GPUs per request to measure by, 1, 2, 4 and 8 by default"},
+		},
+	}
+}
+
+func analyzeFragmentation(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	report, err := s.AnalyzeFragmentation(c.Context, c.StringSlice("nodes"), c.IntSlice("sizes"))
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	o, err := json.Marshal(report)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println(string(o))
+	return nil
+}
@@ -0,0 +1,45 @@
+package gang
+
+import (
+	"encoding/json"
+	"fmt"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+)
+
+func Gang() *cli.Command {
+	return &cli.Command{
+		Name:   "gang",
+		Usage:  "plan all the members of a distributed job across nodes, or nothing",
+		Action: calculateGang,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "nodes", Usage: "the nodes to deploy on", Required: true},
+			&cli.IntFlag{Name: "members", Usage: "the number of members", Required: true},
+			&cli.StringFlag{Name: "request", Usage: "the workload resource request of each member in JSON", Value: "{}"},
+			&cli.StringFlag{Name: "group-by", Usage: "keep all the members on the nodes sharing the value of the label, e.g. rack"},
+		},
+	}
+}
+
+func calculateGang(c *cli.Context) error {
+	req := plugintypes.WorkloadResourceRequest{}
+	if err := json.Unmarshal([]byte(c.String("request")), &req); err != nil {
+		return cli.Exit(err, 128)
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	plan, err := s.CalculateGang(c.Context, c.StringSlice("nodes"), c.Int("members"), req, c.String("group-by"))
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	o, err := json.Marshal(plan)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println(string(o))
+	return nil
+}
@@ -0,0 +1,75 @@
+package label
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func Label() *cli.Command {
+	return &cli.Command{
+		Name:  "label",
+		Usage: "label nodes with where they are, e.g. rack or zone",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "set",
+				Usage:  "replace the labels of node",
+				Action: setLabels,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "node", Usage: "the node", Required: true},
+					&cli.StringSliceFlag{Name: "label", Usage: "a label, e.g. rack=r1"},
+				},
+			},
+			{
+				Name:   "get",
+				Usage:  "get the labels of node",
+				Action: getLabels,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "node", Usage: "the node", Required: true},
+				},
+			},
+		},
+	}
+}
+
+func setLabels(c *cli.Context) error {
+	labels := gputypes.NodeLabels{}
+	for _, v := range c.StringSlice("label") {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return cli.Exit(errors.Wrapf(gputypes.ErrInvalidGang, "label %s is not key=value", v), 128)
+		}
+		labels[key] = value
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := s.SetNodeLabels(c.Context, c.String("node"), labels); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Printf("labels of %s set\n", c.String("node"))
+	return nil
+}
+
+func getLabels(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	labels, err := s.GetNodeLabels(c.Context, c.String("node"))
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	o, err := json.Marshal(labels)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println(string(o))
+	return nil
+}
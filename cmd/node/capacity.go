@@ -25,7 +25,7 @@ func getNodesDeployCapacity(c *cli.Context) error {
 		}
 
 		workloadResource := in.RawParams("workload_resource")
-		return s.GetNodesDeployCapacity(c.Context, nodenames, workloadResource)
+		return s.GetNodesDeployCapacityWithDiagnostics(c.Context, nodenames, workloadResource, in.Bool("strict"), in.Bool("explain"))
 	})
 }
 
@@ -48,6 +48,6 @@ func setNodeResourceCapacity(c *cli.Context) error {
 		delta := in.Bool("delta")
 		resourceRequest := in.RawParams("resource_request")
 		resource := in.RawParams("resource")
-		return s.SetNodeResourceCapacity(c.Context, nodename, resourceRequest, resource, delta, incr)
+		return s.SetNodeResourceCapacity(gpu.WithReason(c.Context, in.String("reason")), nodename, resourceRequest, resource, delta, incr)
 	})
 }
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"time"
+
+	resourcetypes "github.com/projecteru2/core/resource/types"
+	"github.com/projecteru2/core/types"
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	"github.com/yuyang0/resource-gpu/gpu"
+)
+
+func GetNodeResourceHistory() *cli.Command {
+	return &cli.Command{
+		Name:   "get-node-resource-history",
+		Usage:  "get the change history of node, from and to are in RFC3339",
+		Action: getNodeResourceHistory,
+	}
+}
+
+func getNodeResourceHistory(c *cli.Context) error {
+	return cmd.Serve(c, func(s *gpu.Plugin, in resourcetypes.RawParams) (interface{}, error) {
+		nodename := in.String("nodename")
+		if nodename == "" {
+			return nil, types.ErrEmptyNodeName
+		}
+
+		var from, to time.Time
+		var err error
+		if v := in.String("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, err
+			}
+		}
+		if v := in.String("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, err
+			}
+		}
+		return s.GetNodeResourceHistory(c.Context, nodename, from, to)
+	})
+}
@@ -24,6 +24,6 @@ func getMostIdleNode(c *cli.Context) error {
 			return nil, types.ErrEmptyNodeName
 		}
 
-		return s.GetMostIdleNode(c.Context, nodenames)
+		return s.GetMostIdleNodeWithDiagnostics(c.Context, nodenames, in.Bool("strict"))
 	})
 }
@@ -74,6 +74,6 @@ func fixNodeResource(c *cli.Context) error {
 		}
 
 		workloadsResource := in.SliceRawParams("workloads_resource")
-		return s.FixNodeResource(c.Context, nodename, workloadsResource)
+		return s.FixNodeResource(gpu.WithReason(c.Context, in.String("reason")), nodename, workloadsResource)
 	})
 }
@@ -0,0 +1,52 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func WatchNodeResource() *cli.Command {
+	return &cli.Command{
+		Name:   "watch-node-resource",
+		Usage:  "watch the changes of node resource, print them as JSON lines until interrupted, only with the etcd storage",
+		Action: watchNodeResource,
+	}
+}
+
+func watchNodeResource(c *cli.Context) error {
+	// the memory and file storages only tell the changes made by this process,
+	// and the file is locked as long as the watch runs
+	gpuConfig, err := cmd.LoadGPUConfig()
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if storage := gpuConfig.Storage.Type; storage != "" && storage != gputypes.StorageETCD {
+		return cli.Exit(fmt.Sprintf("watch needs the etcd storage, the changes made by other processes can't be watched with %s storage", storage), 128)
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+
+	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	encoder := json.NewEncoder(os.Stdout)
+	for event := range s.WatchNodeResource(ctx) {
+		if err := encoder.Encode(event); err != nil {
+			return cli.Exit(err, 128)
+		}
+	}
+	// the channel is closed by the failure of watch if not interrupted
+	if ctx.Err() == nil {
+		return cli.Exit("watch is closed, e.g. the output lags too far behind", 128)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func Quota() *cli.Command {
+	return &cli.Command{
+		Name:  "quota",
+		Usage: "limit the GPUs tenants may hold cluster-wide",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "set",
+				Usage:  "set the quota of tenant",
+				Action: setQuota,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "tenant", Usage: "the tenant", Required: true},
+					&cli.StringSliceFlag{Name: "limit", Usage: "the limit of a product, e.g. nvidia-a100=16", Required: true},
+				},
+			},
+			{
+				Name:   "list",
+				Usage:  "list the quotas with the usage of tenants",
+				Action: listQuotas,
+			},
+			{
+				Name:   "delete",
+				Usage:  "delete the quota of tenant",
+				Action: deleteQuota,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "tenant", Usage: "the tenant", Required: true},
+				},
+			},
+			{
+				Name:   "repair",
+				Usage:  "rebuild the usage of tenants from the records of allocations",
+				Action: repairUsage,
+			},
+		},
+	}
+}
+
+func setQuota(c *cli.Context) error {
+	limit := gputypes.ProdCountMap{}
+	for _, v := range c.StringSlice("limit") {
+		prod, count, ok := strings.Cut(v, "=")
+		if !ok {
+			return cli.Exit(errors.Wrapf(gputypes.ErrInvalidGPUMap, "limit %s is not product=count", v), 128)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return cli.Exit(errors.Wrapf(gputypes.ErrInvalidGPUMap, "limit %s: %s", v, err), 128)
+		}
+		limit[prod] = n
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := s.SetQuota(c.Context, c.String("tenant"), limit); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Printf("quota of %s set\n", c.String("tenant"))
+	return nil
+}
+
+func listQuotas(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	quotas, err := s.ListQuotas(c.Context)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	o, err := json.Marshal(quotas)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println(string(o))
+	return nil
+}
+
+func deleteQuota(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := s.DeleteQuota(c.Context, c.String("tenant")); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Printf("quota of %s deleted\n", c.String("tenant"))
+	return nil
+}
+
+func repairUsage(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := s.RepairTenantsUsage(c.Context); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println("usage of tenants repaired")
+	return nil
+}
@@ -0,0 +1,112 @@
+package reservation
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func Reservation() *cli.Command {
+	return &cli.Command{
+		Name:  "reservation",
+		Usage: "set aside GPUs for tenants in time windows",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "create",
+				Usage:  "reserve count GPUs on each of nodes, or count GPUs in total across pool",
+				Action: createReservation,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "tenant", Usage: "the tenant the GPUs are reserved for", Required: true},
+					&cli.StringFlag{Name: "product", Usage: "the product of GPUs", Required: true},
+					&cli.StringSliceFlag{Name: "nodes", Usage: "the nodes to reserve count GPUs on each of them"},
+					&cli.StringSliceFlag{Name: "pool", Usage: "the nodes to reserve count GPUs in total"},
+					&cli.IntFlag{Name: "count", Usage: "the number of GPUs", Required: true},
+					&cli.StringFlag{Name: "start", Usage: "the start time in RFC3339, now by default"},
+					&cli.StringFlag{Name: "end", Usage: "the end time in RFC3339", Required: true},
+				},
+			},
+			{
+				Name:   "list",
+				Usage:  "list the reservations",
+				Action: listReservations,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "tenant", Usage: "only list the reservations of tenant"},
+				},
+			},
+			{
+				Name:   "delete",
+				Usage:  "delete a reservation, the workloads deployed by it are kept",
+				Action: deleteReservation,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "id", Usage: "the ID of reservation", Required: true},
+				},
+			},
+		},
+	}
+}
+
+func createReservation(c *cli.Context) error {
+	req := &gputypes.ReservationRequest{
+		Tenant:  c.String("tenant"),
+		Product: c.String("product"),
+		Nodes:   c.StringSlice("nodes"),
+		Pool:    c.StringSlice("pool"),
+		Count:   c.Int("count"),
+		Start:   time.Now(),
+	}
+	var err error
+	if v := c.String("start"); v != "" {
+		if req.Start, err = time.Parse(time.RFC3339, v); err != nil {
+			return cli.Exit(err, 128)
+		}
+	}
+	if req.End, err = time.Parse(time.RFC3339, c.String("end")); err != nil {
+		return cli.Exit(err, 128)
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	reservation, err := s.CreateReservation(c.Context, req)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	return printJSON(reservation)
+}
+
+func listReservations(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	reservations, err := s.ListReservations(c.Context, c.String("tenant"))
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	return printJSON(reservations)
+}
+
+func deleteReservation(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := s.DeleteReservation(c.Context, c.String("id")); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Printf("reservation %s deleted\n", c.String("id"))
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	o, err := json.Marshal(v)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Println(string(o))
+	return nil
+}
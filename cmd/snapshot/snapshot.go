@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yuyang0/resource-gpu/cmd"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func Snapshot() *cli.Command {
+	return &cli.Command{
+		Name:  "snapshot",
+		Usage: "export or import the resource info of all nodes",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "export",
+				Usage:  "dump the resource info of all nodes to a JSON file",
+				Action: exportSnapshot,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Usage: "the snapshot file", Required: true},
+				},
+			},
+			{
+				Name:   "import",
+				Usage:  "restore the resource info of nodes from a JSON file",
+				Action: importSnapshot,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Usage: "the snapshot file", Required: true},
+					&cli.StringFlag{
+						Name:  "mode",
+						Value: gputypes.ImportValidate,
+						Usage: "validate only checks the snapshot, merge keeps the nodes not in snapshot, replace removes them",
+					},
+				},
+			},
+		},
+	}
+}
+
+func exportSnapshot(c *cli.Context) error {
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	snapshot, err := s.ExportSnapshot(c.Context)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	if err := os.WriteFile(c.String("file"), data, 0600); err != nil {
+		return cli.Exit(err, 128)
+	}
+	fmt.Printf("%d nodes exported\n", len(snapshot.Nodes))
+	for _, diagnostic := range snapshot.Corrupt {
+		fmt.Printf("corrupt node left out: %s\n", diagnostic)
+	}
+	return nil
+}
+
+func importSnapshot(c *cli.Context) error {
+	data, err := os.ReadFile(c.String("file"))
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	snapshot := &gputypes.Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return cli.Exit(err, 128)
+	}
+	s, err := cmd.NewPlugin(c)
+	if err != nil {
+		return cli.Exit(err, 128)
+	}
+	r, ierr := s.ImportSnapshot(c.Context, snapshot, c.String("mode"))
+	// the nodes already written are printed even if the import fails halfway
+	if r != nil {
+		o, err := json.Marshal(r)
+		if err != nil {
+			return cli.Exit(err, 128)
+		}
+		fmt.Println(string(o))
+	}
+	if ierr != nil {
+		return cli.Exit(ierr, 128)
+	}
+	return nil
+}
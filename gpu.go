@@ -10,15 +10,30 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/yuyang0/resource-gpu/cmd"
 	"github.com/yuyang0/resource-gpu/cmd/calculate"
+	"github.com/yuyang0/resource-gpu/cmd/fragmentation"
+	"github.com/yuyang0/resource-gpu/cmd/gang"
 	"github.com/yuyang0/resource-gpu/cmd/gpu"
+	"github.com/yuyang0/resource-gpu/cmd/label"
 	"github.com/yuyang0/resource-gpu/cmd/metrics"
 	"github.com/yuyang0/resource-gpu/cmd/node"
+	"github.com/yuyang0/resource-gpu/cmd/quota"
+	"github.com/yuyang0/resource-gpu/cmd/reservation"
+	"github.com/yuyang0/resource-gpu/cmd/snapshot"
 	gpulib "github.com/yuyang0/resource-gpu/gpu"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 	"github.com/yuyang0/resource-gpu/version"
 )
 
 func NewPlugin(ctx context.Context, config coretypes.Config) (plugins.Plugin, error) {
-	p, err := gpulib.NewPlugin(ctx, config, nil)
+	// the config of core doesn't have a gpu section, so load it by ourselves if possible
+	var gpuConfig *gputypes.Config
+	if configPath := os.Getenv("ERU_RESOURCE_CONFIG_PATH"); configPath != "" {
+		var err error
+		if gpuConfig, err = gputypes.LoadConfig(configPath); err != nil {
+			return nil, err
+		}
+	}
+	p, err := gpulib.NewPlugin(ctx, config, gpuConfig)
 	return p, err
 }
 
@@ -45,10 +60,19 @@ func main() {
 		node.SetNodeResourceUsage(),
 		node.GetMostIdleNode(),
 		node.FixNodeResource(),
+		node.GetNodeResourceHistory(),
+		node.WatchNodeResource(),
 
 		calculate.CalculateDeploy(),
 		calculate.CalculateRealloc(),
 		calculate.CalculateRemap(),
+
+		snapshot.Snapshot(),
+		reservation.Reservation(),
+		quota.Quota(),
+		label.Label(),
+		gang.Gang(),
+		fragmentation.Fragmentation(),
 	}
 	app.Flags = []cli.Flag{
 		&cli.StringFlag{
@@ -60,7 +84,7 @@ func main() {
 		},
 		&cli.BoolFlag{
 			Name:        "embedded-storage",
-			Usage:       "active embedded storage",
+			Usage:       "use in-memory storage, same as gpu.storage.type=memory",
 			Destination: &cmd.EmbeddedStorage,
 		},
 	}
@@ -0,0 +1,268 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/log"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/projecteru2/core/utils"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// newAllocID generates the ID of an allocation, eru-core doesn't tell the plugin the IDs of workloads,
+// so the plugin puts its own ID into the workload resource.
+func newAllocID() string {
+	return utils.RandomString(allocIDLength)
+}
+
+// doGetAllocations returns the records of allocations on node by alloc ID
+func (p Plugin) doGetAllocations(ctx context.Context, nodename string) (map[string]*gputypes.WorkloadResource, error) {
+	kvs, err := p.store.GetPrefix(ctx, fmt.Sprintf(allocationPrefix, nodename))
+	if err != nil {
+		return nil, err
+	}
+	allocations := map[string]*gputypes.WorkloadResource{}
+	for _, kv := range kvs {
+		wr, err := p.unmarshalAllocation(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		allocations[utils.Tail(kv.Key)] = wr
+	}
+	return allocations, nil
+}
+
+func (p Plugin) unmarshalAllocation(data []byte) (*gputypes.WorkloadResource, error) {
+	wr := &gputypes.WorkloadResource{}
+	if err := json.Unmarshal(data, wr); err != nil {
+		return nil, err
+	}
+	// init nil maps
+	return wr.DeepCopy(), nil
+}
+
+// doUpdateAllocations applies the workloads resource set to usage to the records,
+// the workloads resource may be the whole resource of workloads or the delta of realloc.
+// The record is removed when the workload holds nothing.
+func (p Plugin) doUpdateAllocations(ctx context.Context, nodename string, workloadsResource []*gputypes.WorkloadResource, incr bool) error {
+	for _, workloadResource := range workloadsResource {
+		// the workloads deployed by older versions have no alloc ID
+		if workloadResource.AllocID == "" {
+			continue
+		}
+		if err := p.doUpdateAllocation(ctx, nodename, workloadResource, incr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p Plugin) doUpdateAllocation(ctx context.Context, nodename string, workloadResource *gputypes.WorkloadResource, incr bool) error {
+	key := fmt.Sprintf(allocationKey, nodename, workloadResource.AllocID)
+	for i := 0; i < maxCASRetries; i++ {
+		var revision int64
+		record := (&gputypes.WorkloadResource{AllocID: workloadResource.AllocID}).DeepCopy() // init nil maps
+		kv, err := p.store.Get(ctx, key)
+		switch {
+		case errors.Is(err, store.ErrKeyNotExists):
+			if !incr {
+				// nothing to release
+				return nil
+			}
+		case err != nil:
+			return err
+		default:
+			if record, err = p.unmarshalAllocation(kv.Value); err != nil {
+				return err
+			}
+			revision = kv.Revision
+		}
+
+		if incr {
+			record.Add(workloadResource)
+			if workloadResource.NUMANode != "" {
+				record.NUMANode = workloadResource.NUMANode
+			}
+			if workloadResource.Alternative != nil {
+				record.Alternative = workloadResource.Alternative.DeepCopy()
+			}
+			if workloadResource.ReservationID != "" {
+				record.ReservationID = workloadResource.ReservationID
+			}
+			if workloadResource.Tenant != "" {
+				record.Tenant = workloadResource.Tenant
+			}
+			if workloadResource.Priority != 0 {
+				record.Priority = workloadResource.Priority
+			}
+		} else {
+			record.Sub(workloadResource)
+		}
+
+		if record.Empty() {
+			// the record may be increased since it's read
+			ok, err := p.store.CompareAndDelete(ctx, key, revision)
+			if err != nil || ok {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		ok, err := p.store.CompareAndSwap(ctx, key, string(data), revision)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "allocation: %s, retried %d times", key, maxCASRetries)
+}
+
+// diffAllocations compares the records of plugin with the workloads of eru-core,
+// returns the workloads whose records are missing or different, and the records not held by any workload.
+func (p Plugin) diffAllocations(ctx context.Context, nodename string, workloadsResource []plugintypes.WorkloadResource) ([]*gputypes.WorkloadResource, []string, []string, error) {
+	allocations, err := p.doGetAllocations(ctx, nodename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	missing := []*gputypes.WorkloadResource{}
+	orphans := []string{}
+	diffs := []string{}
+	held := map[string]bool{}
+	for _, workload := range workloadsResource {
+		workloadResource := &gputypes.WorkloadResource{}
+		if err := workloadResource.Parse(workload); err != nil {
+			return nil, nil, nil, err
+		}
+		if workloadResource.AllocID == "" {
+			continue
+		}
+		workloadResource = workloadResource.DeepCopy() // init nil maps
+		held[workloadResource.AllocID] = true
+
+		record, ok := allocations[workloadResource.AllocID]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("allocation %s of workload is not recorded", workloadResource.AllocID))
+			missing = append(missing, workloadResource)
+		case !sameAllocation(record, workloadResource):
+			diffs = append(diffs, fmt.Sprintf("allocation %s: recorded resource != workload resource", workloadResource.AllocID))
+			missing = append(missing, workloadResource)
+		}
+	}
+	for allocID := range allocations {
+		if !held[allocID] {
+			diffs = append(diffs, fmt.Sprintf("allocation %s is recorded but not held by any workload", allocID))
+			orphans = append(orphans, allocID)
+		}
+	}
+	sort.Strings(orphans)
+	return missing, orphans, diffs, nil
+}
+
+// fixAllocations makes the records the same as the workloads of eru-core
+func (p Plugin) fixAllocations(ctx context.Context, nodename string, workloadsResource []plugintypes.WorkloadResource) error {
+	logger := log.WithFunc("resource.gpu.fixAllocations").WithField("node", nodename)
+	missing, orphans, _, err := p.diffAllocations(ctx, nodename, workloadsResource)
+	if err != nil {
+		return err
+	}
+	for _, workloadResource := range missing {
+		if err := p.doReplaceAllocation(ctx, nodename, workloadResource.AllocID, workloadResource); err != nil {
+			return err
+		}
+		logger.Infof(ctx, "allocation %s is recorded", workloadResource.AllocID)
+	}
+	for _, allocID := range orphans {
+		if err := p.doReplaceAllocation(ctx, nodename, allocID, nil); err != nil {
+			return err
+		}
+		logger.Infof(ctx, "orphan allocation %s is removed", allocID)
+	}
+	return nil
+}
+
+// doRemoveAllocations removes all the records on node
+func (p Plugin) doRemoveAllocations(ctx context.Context, nodename string) error {
+	allocations, err := p.doGetAllocations(ctx, nodename)
+	if err != nil {
+		return err
+	}
+	for allocID := range allocations {
+		if err := p.doReplaceAllocation(ctx, nodename, allocID, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doReplaceAllocation overwrites the record of allocID with record, nil removes it,
+// the usage of tenants is moved from the replaced record to the new one.
+func (p Plugin) doReplaceAllocation(ctx context.Context, nodename, allocID string, record *gputypes.WorkloadResource) error {
+	key := fmt.Sprintf(allocationKey, nodename, allocID)
+	data := []byte{}
+	if record != nil {
+		var err error
+		if data, err = json.Marshal(record); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < maxCASRetries; i++ {
+		var revision int64
+		var replaced *gputypes.WorkloadResource
+		kv, err := p.store.Get(ctx, key)
+		switch {
+		case errors.Is(err, store.ErrKeyNotExists):
+			if record == nil {
+				return nil
+			}
+		case err != nil:
+			return err
+		default:
+			if replaced, err = p.unmarshalAllocation(kv.Value); err != nil {
+				return err
+			}
+			revision = kv.Revision
+		}
+
+		var ok bool
+		if record == nil {
+			ok, err = p.store.CompareAndDelete(ctx, key, revision)
+		} else {
+			ok, err = p.store.CompareAndSwap(ctx, key, string(data), revision)
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if replaced != nil {
+			if err := p.doUpdateTenantsUsage(ctx, []*gputypes.WorkloadResource{replaced}, false); err != nil {
+				return err
+			}
+		}
+		if record != nil {
+			return p.doUpdateTenantsUsage(ctx, []*gputypes.WorkloadResource{record}, true)
+		}
+		return nil
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "allocation: %s, retried %d times", key, maxCASRetries)
+}
+
+func sameAllocation(w1, w2 *gputypes.WorkloadResource) bool {
+	return reflect.DeepEqual(w1.ProdCountMap, w2.ProdCountMap) &&
+		reflect.DeepEqual(w1.AddrCountMap, w2.AddrCountMap) &&
+		reflect.DeepEqual(w1.ProdVRAMMap, w2.ProdVRAMMap) &&
+		reflect.DeepEqual(w1.VRAMMap, w2.VRAMMap) &&
+		reflect.DeepEqual(w1.ProfileCountMap, w2.ProfileCountMap) &&
+		reflect.DeepEqual(w1.MIGCountMap, w2.MIGCountMap)
+}
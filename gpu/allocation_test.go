@@ -0,0 +1,170 @@
+package gpu
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestAllocations(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMap("nvidia-3070", 4, 0)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-allocation", gpuMap)
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 1,
+		},
+	}
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	wrs := []*types.WorkloadResource{}
+	for _, raw := range d.WorkloadsResource {
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(raw))
+		assert.Len(t, wr.AllocID, allocIDLength)
+		wrs = append(wrs, wr)
+	}
+	assert.NotEqual(t, wrs[0].AllocID, wrs[1].AllocID)
+
+	// nothing is recorded before the usage is set
+	allocations, err := cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 0)
+
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 2)
+	assert.Equal(t, wrs[0].AddrCountMap, allocations[wrs[0].AllocID].AddrCountMap)
+
+	// the record is updated by the delta of realloc
+	r, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], req)
+	assert.Nil(t, err)
+	newResource := &types.WorkloadResource{}
+	assert.Nil(t, newResource.Parse(r.WorkloadResource))
+	assert.Equal(t, wrs[0].AllocID, newResource.AllocID)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, []plugintypes.WorkloadResource{r.DeltaResource}, true, true)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Equal(t, newResource.AddrCountMap, allocations[wrs[0].AllocID].AddrCountMap)
+	assert.Equal(t, 2, allocations[wrs[0].AllocID].Count())
+
+	workloadsResource := []plugintypes.WorkloadResource{r.WorkloadResource, d.WorkloadsResource[1]}
+	nr, err := cm.GetNodeResourceInfo(ctx, node, workloadsResource)
+	assert.Nil(t, err)
+	assert.Len(t, nr.Diffs, 0)
+
+	// the record is removed when the workload is released
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource[1:], true, false)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 1)
+
+	// the record of a released workload is reported as orphan and removed by fix
+	nr, err = cm.GetNodeResourceInfo(ctx, node, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, nr.Diffs, "allocation "+wrs[0].AllocID+" is recorded but not held by any workload")
+	_, err = cm.FixNodeResource(ctx, node, nil)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 0)
+
+	// the workload without record is reported and recorded by fix
+	nr, err = cm.GetNodeResourceInfo(ctx, node, workloadsResource[:1])
+	assert.Nil(t, err)
+	assert.Contains(t, nr.Diffs, "allocation "+wrs[0].AllocID+" of workload is not recorded")
+	_, err = cm.FixNodeResource(ctx, node, workloadsResource[:1])
+	assert.Nil(t, err)
+	nr, err = cm.GetNodeResourceInfo(ctx, node, workloadsResource[:1])
+	assert.Nil(t, err)
+	assert.Len(t, nr.Diffs, 0)
+
+	// the records are removed with the node
+	_, err = cm.RemoveNode(ctx, node)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 0)
+	_, err = cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{"gpu_map": gpuMap}, nil)
+	assert.Nil(t, err)
+}
+
+// racingStore runs race once before the first delete by revision, like a write made by another process meanwhile
+type racingStore struct {
+	store.Store
+	race func()
+}
+
+func (s *racingStore) CompareAndDelete(ctx context.Context, key string, revision int64) (bool, error) {
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return s.Store.CompareAndDelete(ctx, key, revision)
+}
+
+func TestAllocationRemovedConcurrently(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-allocation-race", generateGPUMap("nvidia-3070", 4, 0))
+	d, err := cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+	assert.Nil(t, cm.doUpdateAllocation(ctx, node, wr, true))
+
+	// the record is increased after it's read to be released, so it's kept with the increment
+	racing := &racingStore{Store: cm.store}
+	racing.race = func() { assert.Nil(t, cm.doUpdateAllocation(ctx, node, wr, true)) }
+	cm.store = racing
+	assert.Nil(t, cm.doUpdateAllocation(ctx, node, wr, false))
+	cm.store = racing.Store
+
+	kv, err := cm.store.Get(ctx, fmt.Sprintf(allocationKey, node, wr.AllocID))
+	assert.Nil(t, err)
+	record, err := cm.unmarshalAllocation(kv.Value)
+	assert.Nil(t, err)
+	assert.Equal(t, wr.ProdCountMap, record.ProdCountMap)
+}
+
+func TestAllocationsWithUsageOverwritten(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-allocation-overwrite", generateGPUMap("nvidia-3070", 4, 0))
+	d, err := cm.CalculateDeploy(ctx, node, 2, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+
+	// the usage can't be split into the records
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, plugintypes.NodeResource{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}}, nil, false, false)
+	assert.ErrorIs(t, err, types.ErrAllocationsExist)
+	info, err := cm.doGetNodeResourceInfo(ctx, node)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, info.UsageCount())
+
+	// the workloads passed are all the workloads on node
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource[:1], false, false)
+	assert.Nil(t, err)
+	allocations, err := cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 1)
+
+	// the records are cleared with the usage
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, plugintypes.NodeResource{}, nil, false, false)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 0)
+}
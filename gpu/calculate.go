@@ -2,11 +2,16 @@ package gpu
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
+	"github.com/cockroachdb/errors"
+	"github.com/mitchellh/mapstructure"
 	"github.com/projecteru2/core/log"
 	plugintypes "github.com/projecteru2/core/resource/plugins/types"
 	resourcetypes "github.com/projecteru2/core/resource/types"
 	coretypes "github.com/projecteru2/core/types"
+	"github.com/projecteru2/core/utils"
 	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 )
 
@@ -27,20 +32,65 @@ func (p Plugin) CalculateDeploy(
 		return nil, err
 	}
 
-	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
-	if err != nil {
-		logger.WithField("node", nodename).Error(ctx, err)
-		return nil, err
-	}
-
 	var enginesParams []*gputypes.EngineParams
 	var workloadsResource []*gputypes.WorkloadResource
+	reserved := false
+	// the plan is recalculated if another deployment reserved GPUs on the node meanwhile
+	for i := 0; i < maxCASRetries && !reserved; i++ {
+		nodeResourceInfo, revision, err := p.doGetNodeResourceInfoWithProvisionals(ctx, nodename)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+		if err := p.doApplyReservations(ctx, map[string]*gputypes.NodeResourceInfo{nodename: nodeResourceInfo}, req.ReservationID, req.Tenant); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+		if enginesParams, workloadsResource, err = p.doCalculateDeploy(nodename, nodeResourceInfo, deployCount, req); err != nil {
+			insufficient := &gputypes.InsufficientResourceError{}
+			if req.Preempt && errors.As(err, &insufficient) {
+				plan, perr := p.doPlanPreemption(ctx, nodename, nodeResourceInfo, deployCount, req)
+				if perr != nil {
+					logger.Error(ctx, perr, "failed to plan preemption")
+					return nil, perr
+				}
+				if plan != nil {
+					err = &gputypes.PreemptionRequiredError{InsufficientResourceError: insufficient, Plan: plan}
+				}
+			}
+			logger.Error(ctx, err)
+			return nil, err
+		}
+		if !p.provisionalEnabled() {
+			break
+		}
+		if reserved, err = p.doReserveProvisionals(ctx, nodename, workloadsResource, revision); err != nil {
+			logger.Error(ctx, err, "failed to reserve")
+			return nil, err
+		}
+	}
+	if p.provisionalEnabled() && !reserved {
+		return nil, errors.Wrapf(gputypes.ErrConflict, "node: %s, reservation retried %d times", nodename, maxCASRetries)
+	}
 
-	enginesParams, workloadsResource, err = p.doAlloc(nodeResourceInfo, deployCount, req)
-	if err != nil {
+	incr := gputypes.ProdCountMap{}
+	for _, wr := range workloadsResource {
+		incr.Add(wr.ProdCountMap)
+	}
+	if err := p.checkQuota(ctx, req.Tenant, incr, workloadsResource); err != nil {
+		logger.Error(ctx, err)
+		if reserved {
+			if err := p.doConfirmProvisionals(ctx, nodename, workloadsResource); err != nil {
+				logger.Warnf(ctx, "failed to release reservations: %+v", err)
+			}
+		}
 		return nil, err
 	}
 
+	return p.deployResponse(enginesParams, workloadsResource), nil
+}
+
+func (p Plugin) deployResponse(enginesParams []*gputypes.EngineParams, workloadsResource []*gputypes.WorkloadResource) *plugintypes.CalculateDeployResponse {
 	epRaws := make([]resourcetypes.RawParams, 0, len(enginesParams))
 	for _, ep := range enginesParams {
 		epRaws = append(epRaws, ep.AsRawParams())
@@ -52,7 +102,42 @@ func (p Plugin) CalculateDeploy(
 	return &plugintypes.CalculateDeployResponse{
 		EnginesParams:     epRaws,
 		WorkloadsResource: wrRaws,
-	}, nil
+	}
+}
+
+// doCalculateDeploy plans the workloads on node, the insufficient resource is explained
+func (p Plugin) doCalculateDeploy(nodename string, nodeResourceInfo *gputypes.NodeResourceInfo, deployCount int, req *gputypes.WorkloadResourceRequest) ([]*gputypes.EngineParams, []*gputypes.WorkloadResource, error) {
+	var enginesParams []*gputypes.EngineParams
+	var workloadsResource []*gputypes.WorkloadResource
+	var err error
+
+	// the alternatives are tried in order, and all the workloads on this node will use the same one
+	for _, altReq := range req.Expand() {
+		if enginesParams, workloadsResource, err = p.doAlloc(nodeResourceInfo, deployCount, altReq, nil); err == nil {
+			if len(req.Alternatives) > 0 {
+				for _, wr := range workloadsResource {
+					wr.Alternative = altReq.ProdCountMap.DeepCopy()
+				}
+			}
+			break
+		}
+	}
+	if errors.Is(err, coretypes.ErrInsufficientResource) {
+		_, explanation := p.doGetNodeDeployCapacity(nodeResourceInfo, req)
+		explanation.Nodename = nodename
+		return nil, nil, &gputypes.InsufficientResourceError{DeployCount: deployCount, Explanation: explanation}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// the records of allocations are written when eru-core sets the usage
+	for _, wr := range workloadsResource {
+		wr.AllocID = newAllocID()
+		wr.ReservationID = req.ReservationID
+		wr.Tenant = req.Tenant
+		wr.Priority = req.Priority
+	}
+	return enginesParams, workloadsResource, nil
 }
 
 // CalculateRealloc .
@@ -78,27 +163,68 @@ func (p Plugin) CalculateRealloc(
 	if err := originResource.Validate(); err != nil {
 		return nil, err
 	}
-	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
+	// the GPUs reserved by the deployments in progress can't be reallocated
+	nodeResourceInfo, _, err := p.doGetNodeResourceInfoWithProvisionals(ctx, nodename)
 	if err != nil {
 		log.WithFunc("resource.gpu.CalculateRealloc").WithField("node", nodename).Error(ctx, err, "failed to get resource info of node")
 		return nil, err
 	}
+	// the workload keeps its tenant, its priority and the reservation it's deployed by
+	tenant := originResource.Tenant
+	if req.Tenant != "" {
+		tenant = req.Tenant
+	}
+	reservationID := req.ReservationID
+	if reservationID == "" && originResource.ReservationID != "" {
+		reservation, err := p.doGetReservation(ctx, originResource.ReservationID)
+		if err != nil {
+			return nil, err
+		}
+		// the reservation may be deleted or expired, then the workload is reallocated without it
+		if reservation != nil && reservation.Tenant == tenant {
+			reservationID = originResource.ReservationID
+		}
+	}
+	// 0 means keep, the records don't tell the priority 0 set from the one not set
+	priority := originResource.Priority
+	if req.Priority > 0 {
+		priority = req.Priority
+	}
+	if err := p.doApplyReservations(ctx, map[string]*gputypes.NodeResourceInfo{nodename: nodeResourceInfo}, reservationID, tenant); err != nil {
+		return nil, err
+	}
 
 	// put resources back into the resource pool
 	nodeResourceInfo.Usage.Sub(&gputypes.NodeResource{
 		ProdCountMap: originResource.ProdCountMap,
+		AddrCountMap: originResource.AddrCountMap,
+		VRAMMap:      originResource.VRAMMap,
+		MIGCountMap:  originResource.MIGCountMap,
 	})
 
-	newReq := req.DeepCopy()
-	newReq.MergeFromResource(originResource)
-
-	if err = newReq.Validate(); err != nil {
-		return nil, err
-	}
-
 	var enginesParams []*gputypes.EngineParams
 	var workloadsResource []*gputypes.WorkloadResource
-	if enginesParams, workloadsResource, err = p.doAlloc(nodeResourceInfo, 1, newReq); err != nil {
+	// the alternatives are tried in order, each of them is applied to origin
+	for _, altReq := range req.Expand() {
+		newReq := p.resolveReleasedProds(altReq, originResource)
+		newReq.MergeFromResource(originResource)
+
+		if err = newReq.Validate(); err != nil {
+			return nil, err
+		}
+		if enginesParams, workloadsResource, err = p.doAlloc(nodeResourceInfo, 1, newReq, originResource); err == nil {
+			workloadsResource[0].Alternative = originResource.Alternative
+			workloadsResource[0].AllocID = originResource.AllocID
+			workloadsResource[0].ReservationID = reservationID
+			workloadsResource[0].Tenant = tenant
+			workloadsResource[0].Priority = priority
+			if len(req.Alternatives) > 0 {
+				workloadsResource[0].Alternative = altReq.ProdCountMap.DeepCopy()
+			}
+			break
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -107,6 +233,9 @@ func (p Plugin) CalculateRealloc(
 
 	deltaWorkloadResource := newResource.DeepCopy()
 	deltaWorkloadResource.Sub(originResource)
+	if err := p.checkQuota(ctx, tenant, deltaWorkloadResource.ProdCountMap, nil); err != nil {
+		return nil, err
+	}
 
 	return &plugintypes.CalculateReallocResponse{
 		EngineParams:     engineParams.AsRawParams(),
@@ -115,41 +244,434 @@ func (p Plugin) CalculateRealloc(
 	}, nil
 }
 
-// CalculateRemap .
-func (p Plugin) CalculateRemap(context.Context, string, map[string]plugintypes.WorkloadResource) (*plugintypes.CalculateRemapResponse, error) {
-	return &plugintypes.CalculateRemapResponse{
-		EngineParamsMap: nil,
-	}, nil
+// CalculateRemap recomputes the engine params of the workloads holding devices against the current device inventory,
+// e.g. the UUIDs or the NUMA nodes of the devices may be changed by SetNodeResourceCapacity.
+// The devices recorded in workload resource are kept, the shared cards are NOT compacted:
+// eru-core doesn't save workload resource after remap, so moving a workload to other devices
+// would leave core releasing the old devices when the workload is removed, and corrupt the usage.
+// Nothing is written either: core applies the engine params to the engine and never sets the usage after remap,
+// so there is no point to save a new placement which core may never apply.
+func (p Plugin) CalculateRemap(ctx context.Context, nodename string, workloadsResource map[string]plugintypes.WorkloadResource) (*plugintypes.CalculateRemapResponse, error) {
+	resp := &plugintypes.CalculateRemapResponse{}
+	engineParamsMap := map[string]*gputypes.EngineParams{}
+	if len(workloadsResource) == 0 {
+		return resp, mapstructure.Decode(map[string]any{
+			"engine_params_map": engineParamsMap,
+		}, resp)
+	}
+
+	workloadResourceMap := map[string]*gputypes.WorkloadResource{}
+	for ID, workload := range workloadsResource {
+		workloadResource := &gputypes.WorkloadResource{}
+		if err := workloadResource.Parse(workload); err != nil {
+			return nil, err
+		}
+		workloadResourceMap[ID] = workloadResource
+	}
+
+	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
+	if err != nil {
+		log.WithFunc("resource.gpu.CalculateRemap").WithField("node", nodename).Error(ctx, err)
+		return nil, err
+	}
+
+	for ID, workloadResource := range workloadResourceMap {
+		// only process workloads with devices
+		if len(workloadResource.AddrCountMap) == 0 && len(workloadResource.VRAMMap) == 0 && len(workloadResource.MIGCountMap) == 0 {
+			continue
+		}
+		engineParams := p.engineParamsOf(nodeResourceInfo.Capacity, workloadResource)
+		engineParams.Remap = true
+		engineParamsMap[ID] = engineParams
+	}
+
+	return resp, mapstructure.Decode(map[string]any{
+		"engine_params_map": engineParamsMap,
+	}, resp)
+}
+
+// engineParamsOf builds the engine params of the workload from the device inventory,
+// the devices not in the inventory any more are ignored.
+func (p Plugin) engineParamsOf(capacity *gputypes.NodeResource, workloadResource *gputypes.WorkloadResource) *gputypes.EngineParams {
+	// the shared devices are passed through too
+	addrs := []string{}
+	for addr := range workloadResource.AddrCountMap {
+		addrs = append(addrs, addr)
+	}
+	for addr := range workloadResource.VRAMMap {
+		addrs = append(addrs, addr)
+	}
+	gpuMap := gputypes.GPUMap{}
+	for _, addr := range addrs {
+		if info, ok := capacity.GPUMap[addr]; ok {
+			info.Address = addr
+			gpuMap[addr] = info
+		}
+	}
+	migMap := gputypes.MIGMap{}
+	// the parent GPUs are only used to find out the NUMA node
+	devices := gpuMap.DeepCopy()
+	for uuid := range workloadResource.MIGCountMap {
+		if info, ok := capacity.MIGMap[uuid]; ok {
+			info.UUID = uuid
+			migMap[uuid] = info
+			devices[info.Parent] = capacity.GPUMap[info.Parent]
+		}
+	}
+	return &gputypes.EngineParams{
+		ProdCountMap: workloadResource.ProdCountMap.DeepCopy(),
+		GPUMap:       gpuMap,
+		NUMANode:     capacity.NUMA.NodeIDOf(devices),
+		VRAMMap:      workloadResource.VRAMMap.DeepCopy(),
+		MIGMap:       migMap,
+	}
 }
 
-func (p Plugin) doAlloc(resourceInfo *gputypes.NodeResourceInfo, deployCount int, req *gputypes.WorkloadResourceRequest) ([]*gputypes.EngineParams, []*gputypes.WorkloadResource, error) {
+// doAlloc allocates GPUs for each workload, if the node has a device inventory of the requested product,
+// concrete devices will be picked, and the devices held by origin are preferred in order to keep them for realloc.
+func (p Plugin) doAlloc(resourceInfo *gputypes.NodeResourceInfo, deployCount int, req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) ([]*gputypes.EngineParams, []*gputypes.WorkloadResource, error) {
 	enginesParams := []*gputypes.EngineParams{}
 	workloadsResource := []*gputypes.WorkloadResource{}
-	var err error
 
 	availableResource := resourceInfo.GetAvailableResource()
 	for i := 0; i < deployCount; i++ {
-		prodCountMap := gputypes.ProdCountMap{}
-		for reqProd, reqCount := range req.ProdCountMap {
-			capCount, ok := availableResource.ProdCountMap[reqProd]
-			if !ok || capCount < reqCount {
-				err = coretypes.ErrInsufficientResource
-				return enginesParams, workloadsResource, err
+		workloadReq, err := p.resolveProds(resourceInfo, availableResource, req, origin)
+		if err != nil {
+			return enginesParams, workloadsResource, err
+		}
+		for reqProd, reqCount := range workloadReq.ProdCountMap {
+			if capCount, ok := availableResource.ProdCountMap[reqProd]; !ok || capCount < reqCount {
+				return enginesParams, workloadsResource, coretypes.ErrInsufficientResource
 			}
-			availableResource.ProdCountMap[reqProd] -= reqCount
-			prodCountMap[reqProd] = reqCount
 		}
-		if req.Count() == prodCountMap.TotalCount() {
-			workloadsResource = append(workloadsResource, &gputypes.WorkloadResource{
-				ProdCountMap: prodCountMap.DeepCopy(),
-			})
-			enginesParams = append(enginesParams, &gputypes.EngineParams{
-				ProdCountMap: prodCountMap.DeepCopy(),
-			})
+		gpuMap, err := p.pickGPUs(resourceInfo, availableResource.GPUMap, workloadReq, origin)
+		if err != nil {
+			return enginesParams, workloadsResource, err
+		}
+		availableResource.ProdCountMap.Sub(workloadReq.ProdCountMap)
+		availableResource.GPUMap.Sub(gpuMap)
+
+		addrCountMap := gputypes.AddrCountMap{}
+		for addr := range gpuMap {
+			addrCountMap[addr] = 1
+			delete(availableResource.VRAMMap, addr)
+		}
+
+		vramMap, err := p.pickVRAM(resourceInfo, availableResource.VRAMMap, workloadReq, origin)
+		if err != nil {
+			return enginesParams, workloadsResource, err
+		}
+		availableResource.VRAMMap.Sub(vramMap)
+		for addr := range vramMap {
+			// a shared device can't be held by a single workload any more
+			delete(availableResource.GPUMap, addr)
+		}
+
+		migMap, err := p.pickMIGs(availableResource.MIGMap, workloadReq, origin)
+		if err != nil {
+			return enginesParams, workloadsResource, err
+		}
+		availableResource.MIGMap.Sub(migMap)
+		migCountMap := gputypes.AddrCountMap{}
+		for uuid := range migMap {
+			migCountMap[uuid] = 1
+		}
+
+		workloadResource := &gputypes.WorkloadResource{
+			ProdCountMap:    workloadReq.ProdCountMap.DeepCopy(),
+			AddrCountMap:    addrCountMap,
+			ProdVRAMMap:     workloadReq.ProdVRAMMap.DeepCopy(),
+			VRAMMap:         vramMap,
+			ProfileCountMap: workloadReq.ProfileCountMap.DeepCopy(),
+			MIGCountMap:     migCountMap,
+		}
+		engineParams := p.engineParamsOf(resourceInfo.Capacity, workloadResource)
+		workloadResource.NUMANode = engineParams.NUMANode
+		workloadsResource = append(workloadsResource, workloadResource)
+		enginesParams = append(enginesParams, engineParams)
+	}
+	return enginesParams, workloadsResource, nil
+}
+
+// flexiblePart is a part of request which can be satisfied by any of the products,
+// the products are ordered by preference.
+type flexiblePart struct {
+	// name is the alias, pattern or constraint requested, or min_vram for the GPUs requested by VRAM per card
+	name  string
+	prods []string
+	count int
+}
+
+// splitRequest splits the GPUs requested by count into the concrete products
+// and the parts requested by aliases, wildcard patterns, constraints or VRAM per card.
+func (p Plugin) splitRequest(resourceInfo *gputypes.NodeResourceInfo, req *gputypes.WorkloadResourceRequest) (gputypes.ProdCountMap, []flexiblePart) {
+	prods := []string{}
+	for prod := range resourceInfo.Capacity.ProdCountMap {
+		prods = append(prods, prod)
+	}
+	sort.Strings(prods)
+
+	fixed := gputypes.ProdCountMap{}
+	patterns := []string{}
+	for prod, count := range req.ProdCountMap {
+		if p.gpuConfig.IsProdPattern(prod) {
+			patterns = append(patterns, prod)
 		} else {
-			err = coretypes.ErrInsufficientResource
-			break
+			fixed[prod] = count
+		}
+	}
+	sort.Strings(patterns)
+	parts := []flexiblePart{}
+	for _, pattern := range patterns {
+		parts = append(parts, flexiblePart{name: pattern, prods: p.gpuConfig.MatchProds(pattern, prods), count: req.ProdCountMap[pattern]})
+	}
+
+	if req.MinVRAMCount > 0 {
+		// the product with the least VRAM is preferred in order to keep the larger cards
+		// for the workloads which really need them.
+		candidates := []string{}
+		for _, prod := range prods {
+			if p.vramOf(resourceInfo, prod) >= req.MinVRAM {
+				candidates = append(candidates, prod)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return p.vramOf(resourceInfo, candidates[i]) < p.vramOf(resourceInfo, candidates[j])
+		})
+		parts = append(parts, flexiblePart{name: fmt.Sprintf("min_vram:%d", req.MinVRAM), prods: candidates, count: req.MinVRAMCount})
+	}
+	return fixed, parts
+}
+
+// vramOf returns the VRAM per card of the product on the node, the catalog is used if the node doesn't know it
+func (p Plugin) vramOf(resourceInfo *gputypes.NodeResourceInfo, prod string) int64 {
+	if vram := resourceInfo.Capacity.VRAMOf(prod); vram > 0 {
+		return vram
+	}
+	return p.gpuConfig.Products[prod].VRAM
+}
+
+// resolveProds turns the flexible parts of request into GPUs of concrete products,
+// all the GPUs of a part are of the same product, and the product held by origin is preferred.
+func (p Plugin) resolveProds(resourceInfo *gputypes.NodeResourceInfo, available *gputypes.NodeResource, req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) (*gputypes.WorkloadResourceRequest, error) {
+	fixed, parts := p.splitRequest(resourceInfo, req)
+	if len(parts) == 0 {
+		return req, nil
+	}
+	res := req.DeepCopy()
+	res.ProdCountMap = fixed
+	res.MinVRAM, res.MinVRAMCount = 0, 0
+	for _, part := range parts {
+		prod := p.pickProd(resourceInfo, available, res.ProdCountMap, part, origin)
+		if prod == "" {
+			return nil, coretypes.ErrInsufficientResource
+		}
+		res.ProdCountMap[prod] += part.count
+	}
+	return res, nil
+}
+
+// pickProd returns the first product of the part which has enough free GPUs besides the requested ones,
+// empty string will be returned if there is no such product.
+func (p Plugin) pickProd(resourceInfo *gputypes.NodeResourceInfo, available *gputypes.NodeResource, requested gputypes.ProdCountMap, part flexiblePart, origin *gputypes.WorkloadResource) string {
+	prods := append([]string{}, part.prods...)
+	if origin != nil {
+		sort.SliceStable(prods, func(i, j int) bool {
+			_, iok := origin.ProdCountMap[prods[i]]
+			_, jok := origin.ProdCountMap[prods[j]]
+			return iok && !jok
+		})
+	}
+	for _, prod := range prods {
+		if p.freeCount(resourceInfo, available, prod)-requested[prod] >= part.count {
+			return prod
+		}
+	}
+	return ""
+}
+
+// resolveReleasedProds turns the negative counts of aliases or wildcard patterns
+// into the concrete products held by origin.
+func (p Plugin) resolveReleasedProds(req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) *gputypes.WorkloadResourceRequest {
+	prods := []string{}
+	for prod := range origin.ProdCountMap {
+		prods = append(prods, prod)
+	}
+	res := req.DeepCopy()
+	for pattern, count := range req.ProdCountMap {
+		if count >= 0 || !p.gpuConfig.IsProdPattern(pattern) {
+			continue
+		}
+		delete(res.ProdCountMap, pattern)
+		for _, prod := range p.gpuConfig.MatchProds(pattern, prods) {
+			if release := utils.Min(-count, origin.ProdCountMap[prod]+res.ProdCountMap[prod]); release > 0 {
+				res.ProdCountMap[prod] -= release
+				count += release
+			}
+		}
+	}
+	return res
+}
+
+// pickGPUs picks the devices of the requested products which have a device inventory,
+// the devices on a single NUMA node are preferred, if no NUMA node can hold all of them,
+// the devices will be picked across NUMA nodes.
+func (p Plugin) pickGPUs(resourceInfo *gputypes.NodeResourceInfo, available gputypes.GPUMap, req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) (gputypes.GPUMap, error) {
+	tracked := gputypes.ProdCountMap{}
+	for prod, count := range req.ProdCountMap {
+		if resourceInfo.Capacity.GPUMap.HasProd(prod) {
+			tracked[prod] = count
+		}
+	}
+	if len(tracked) == 0 {
+		return gputypes.GPUMap{}, nil
+	}
+
+	numa := resourceInfo.Capacity.NUMA
+	if numaNode := p.pickNUMANode(available, numa, tracked, origin); numaNode != "" {
+		candidates := gputypes.GPUMap{}
+		for addr, info := range available {
+			if numa[addr] == numaNode {
+				candidates[addr] = info
+			}
+		}
+		available = candidates
+	}
+
+	gpuMap := gputypes.GPUMap{}
+	for prod, count := range tracked {
+		gpus := p.sortGPUs(available.ListByProd(prod), origin)
+		if len(gpus) < count {
+			return nil, coretypes.ErrInsufficientResource
+		}
+		for _, info := range gpus[:count] {
+			gpuMap[info.Address] = info
 		}
 	}
-	return enginesParams, workloadsResource, err
+	return gpuMap, nil
+}
+
+// pickNUMANode returns the NUMA node which can hold all the requested devices,
+// the NUMA node of origin is preferred, otherwise the one with the least free devices is chosen
+// in order to leave larger blocks for other workloads.
+// empty string will be returned if there is no such NUMA node.
+func (p Plugin) pickNUMANode(available gputypes.GPUMap, numa gputypes.NUMA, tracked gputypes.ProdCountMap, origin *gputypes.WorkloadResource) string {
+	if len(numa) == 0 {
+		return ""
+	}
+	numaGPUs := map[string]gputypes.GPUMap{}
+	for addr, info := range available {
+		nodeID, ok := numa[addr]
+		if !ok {
+			continue
+		}
+		if _, ok := numaGPUs[nodeID]; !ok {
+			numaGPUs[nodeID] = gputypes.GPUMap{}
+		}
+		numaGPUs[nodeID][addr] = info
+	}
+
+	candidates := []string{}
+	for nodeID, gpuMap := range numaGPUs {
+		prodCountMap := gpuMap.ProdCountMap()
+		fit := true
+		for prod, count := range tracked {
+			if prodCountMap[prod] < count {
+				fit = false
+				break
+			}
+		}
+		if fit {
+			candidates = append(candidates, nodeID)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		li, lj := len(numaGPUs[candidates[i]]), len(numaGPUs[candidates[j]])
+		if li != lj {
+			return li < lj
+		}
+		return candidates[i] < candidates[j]
+	})
+	if origin != nil && origin.NUMANode != "" {
+		for _, nodeID := range candidates {
+			if nodeID == origin.NUMANode {
+				return nodeID
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// pickVRAM picks a shared device for each requested VRAM slice,
+// the device held by origin is preferred, otherwise the device with the least free VRAM is chosen
+// in order to keep the other devices free for whole allocation.
+func (p Plugin) pickVRAM(resourceInfo *gputypes.NodeResourceInfo, available gputypes.VRAMMap, req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) (gputypes.VRAMMap, error) {
+	vramMap := gputypes.VRAMMap{}
+	for prod, vram := range req.ProdVRAMMap {
+		candidates := []string{}
+		for addr, free := range available {
+			if _, ok := vramMap[addr]; ok {
+				continue
+			}
+			if resourceInfo.Capacity.GPUMap[addr].Product == prod && free >= vram {
+				candidates = append(candidates, addr)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, coretypes.ErrInsufficientResource
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if origin != nil {
+				_, iok := origin.VRAMMap[candidates[i]]
+				_, jok := origin.VRAMMap[candidates[j]]
+				if iok != jok {
+					return iok
+				}
+			}
+			if available[candidates[i]] != available[candidates[j]] {
+				return available[candidates[i]] < available[candidates[j]]
+			}
+			return candidates[i] < candidates[j]
+		})
+		vramMap[candidates[0]] = vram
+	}
+	return vramMap, nil
+}
+
+// pickMIGs picks the MIG instances of the requested profiles, the instances held by origin are preferred
+func (p Plugin) pickMIGs(available gputypes.MIGMap, req *gputypes.WorkloadResourceRequest, origin *gputypes.WorkloadResource) (gputypes.MIGMap, error) {
+	migMap := gputypes.MIGMap{}
+	for profile, count := range req.ProfileCountMap {
+		migs := available.ListByProfile(profile)
+		if len(migs) < count {
+			return nil, coretypes.ErrInsufficientResource
+		}
+		if origin != nil {
+			sort.SliceStable(migs, func(i, j int) bool {
+				_, iok := origin.MIGCountMap[migs[i].UUID]
+				_, jok := origin.MIGCountMap[migs[j].UUID]
+				return iok && !jok
+			})
+		}
+		for _, info := range migs[:count] {
+			migMap[info.UUID] = info
+		}
+	}
+	return migMap, nil
+}
+
+// sortGPUs moves the GPUs held by origin to the front, the relative order of other GPUs is kept
+func (p Plugin) sortGPUs(gpus []gputypes.GPUInfo, origin *gputypes.WorkloadResource) []gputypes.GPUInfo {
+	if origin == nil || len(origin.AddrCountMap) == 0 {
+		return gpus
+	}
+	sort.SliceStable(gpus, func(i, j int) bool {
+		_, iok := origin.AddrCountMap[gpus[i].Address]
+		_, jok := origin.AddrCountMap[gpus[j].Address]
+		return iok && !jok
+	})
+	return gpus
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/docker/go-units"
 	plugintypes "github.com/projecteru2/core/resource/plugins/types"
 	coretypes "github.com/projecteru2/core/types"
 	"github.com/stretchr/testify/assert"
@@ -283,5 +284,642 @@ func TestCalculateRemap(t *testing.T) {
 	d, err := cm.CalculateRemap(ctx, node, nil)
 
 	assert.NoError(t, err)
-	assert.Nil(t, d.EngineParamsMap)
+	assert.Empty(t, d.EngineParamsMap)
+
+	// the workloads without devices are not remapped
+	d, err = cm.CalculateRemap(ctx, node, map[string]plugintypes.WorkloadResource{
+		"w1": {"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, d.EngineParamsMap)
+}
+
+func TestCalculateRemapWithGPUMap(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMapWithVRAM("nvidia-a10", 4, 0, 24*units.GiB)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-remap", gpuMap)
+
+	d, err := cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-a10": 2},
+	})
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	d1, err := cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{
+		"prod_vram_map": types.VRAMMap{"nvidia-a10": 6 * units.GiB},
+	})
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d1.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	workloadsResource := append(d.WorkloadsResource, d1.WorkloadsResource...)
+
+	// the devices are reinstalled with new UUIDs and NUMA nodes are detected
+	numa := types.NUMA{}
+	for addr, info := range gpuMap {
+		info.UUID += "-new"
+		gpuMap[addr] = info
+		numa[addr] = "0"
+	}
+	_, err = cm.SetNodeResourceCapacity(ctx, node, plugintypes.NodeResourceRequest{
+		"gpu_map": gpuMap,
+		"numa":    numa,
+	}, nil, false, false)
+	assert.Nil(t, err)
+
+	before, err := cm.ExportSnapshot(ctx)
+	assert.Nil(t, err)
+	r, err := cm.CalculateRemap(ctx, node, map[string]plugintypes.WorkloadResource{
+		"w1": workloadsResource[0],
+		"w2": workloadsResource[1],
+	})
+	assert.Nil(t, err)
+	assert.Len(t, r.EngineParamsMap, 2)
+	// nothing is written by remap
+	after, err := cm.ExportSnapshot(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, before.Nodes, after.Nodes)
+	assert.Equal(t, before.Allocations, after.Allocations)
+	for ID, workloadResource := range map[string]plugintypes.WorkloadResource{"w1": workloadsResource[0], "w2": workloadsResource[1]} {
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(workloadResource))
+		ep := &types.EngineParams{}
+		assert.Nil(t, ep.Parse(r.EngineParamsMap[ID]))
+		assert.True(t, ep.Remap)
+		assert.Equal(t, "0", ep.NUMANode)
+		assert.Equal(t, wr.VRAMMap, ep.VRAMMap)
+		assert.Equal(t, len(wr.AddrCountMap)+len(wr.VRAMMap), len(ep.GPUMap))
+		for addr, info := range ep.GPUMap {
+			assert.Equal(t, addr, info.Address)
+			assert.Equal(t, gpuMap[addr].UUID, info.UUID)
+		}
+	}
+}
+
+func TestCalculateDeployWithGPUMap(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMap("nvidia-3070", 4, 0)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-gpu-map", gpuMap)
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 2,
+		},
+	}
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	assert.Len(t, d.EnginesParams, 2)
+
+	addrs := map[string]struct{}{}
+	for i, epRaw := range d.EnginesParams {
+		ep := &types.EngineParams{}
+		assert.Nil(t, ep.Parse(epRaw))
+		assert.Len(t, ep.GPUMap, 2)
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[i]))
+		assert.Len(t, wr.AddrCountMap, 2)
+		for addr, info := range ep.GPUMap {
+			assert.Equal(t, gpuMap[addr], info)
+			_, ok := wr.AddrCountMap[addr]
+			assert.True(t, ok)
+			addrs[addr] = struct{}{}
+		}
+	}
+	// every workload gets its own devices
+	assert.Len(t, addrs, 4)
+
+	_, err = cm.CalculateDeploy(ctx, node, 3, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	// the devices held by the first workload can't be allocated again
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource[:1], true, true)
+	assert.Nil(t, err)
+	d1, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d1.WorkloadsResource[0]))
+	origin := &types.WorkloadResource{}
+	assert.Nil(t, origin.Parse(d.WorkloadsResource[0]))
+	for addr := range wr.AddrCountMap {
+		_, ok := origin.AddrCountMap[addr]
+		assert.False(t, ok)
+	}
+
+	// realloc keeps the devices held by the workload
+	req = plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 1,
+		},
+	}
+	r, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], req)
+	assert.Nil(t, err)
+	newResource := &types.WorkloadResource{}
+	assert.Nil(t, newResource.Parse(r.WorkloadResource))
+	assert.Len(t, newResource.AddrCountMap, 3)
+	for addr := range origin.AddrCountMap {
+		_, ok := newResource.AddrCountMap[addr]
+		assert.True(t, ok)
+	}
+	delta := &types.WorkloadResource{}
+	assert.Nil(t, delta.Parse(r.DeltaResource))
+	assert.Len(t, delta.AddrCountMap, 1)
+
+	// shrink, the released device is reported by a negative count in delta
+	req = plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": -1,
+		},
+	}
+	r, err = cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], req)
+	assert.Nil(t, err)
+	delta = &types.WorkloadResource{}
+	assert.Nil(t, delta.Parse(r.DeltaResource))
+	assert.Len(t, delta.AddrCountMap, 1)
+	for addr, count := range delta.AddrCountMap {
+		assert.Equal(t, -1, count)
+		_, ok := origin.AddrCountMap[addr]
+		assert.True(t, ok)
+	}
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, []plugintypes.WorkloadResource{r.DeltaResource}, true, true)
+	assert.Nil(t, err)
+	nr, err := cm.GetNodeResourceInfo(ctx, node, nil)
+	assert.Nil(t, err)
+	usage := &types.NodeResource{}
+	assert.Nil(t, usage.Parse(nr.Usage))
+	assert.Equal(t, 1, usage.Count())
+	assert.Len(t, usage.AddrCountMap, 1)
+}
+
+func TestCalculateDeployWithNUMA(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMap("nvidia-3070", 4, 0)
+	numa := types.NUMA{
+		"0000:00:00.0": "0",
+		"0000:01:00.0": "0",
+		"0000:02:00.0": "1",
+		"0000:03:00.0": "1",
+	}
+	node := "test-numa"
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"gpu_map": gpuMap,
+		"numa":    numa,
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+
+	// occupy a device on NUMA node 0
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, []plugintypes.WorkloadResource{
+		{
+			"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+			"addr_count_map": types.AddrCountMap{"0000:00:00.0": 1},
+		},
+	}, true, true)
+	assert.Nil(t, err)
+
+	deploy := func(count int) *types.EngineParams {
+		req := plugintypes.WorkloadResourceRequest{
+			"prod_count_map": types.ProdCountMap{
+				"nvidia-3070": count,
+			},
+		}
+		d, err := cm.CalculateDeploy(ctx, node, 1, req)
+		assert.Nil(t, err)
+		ep := &types.EngineParams{}
+		assert.Nil(t, ep.Parse(d.EnginesParams[0]))
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+		assert.Equal(t, ep.NUMANode, wr.NUMANode)
+		assert.Len(t, ep.GPUMap, count)
+		return ep
+	}
+
+	// only NUMA node 1 can hold 2 devices
+	ep := deploy(2)
+	assert.Equal(t, "1", ep.NUMANode)
+	for addr := range ep.GPUMap {
+		assert.Equal(t, "1", numa[addr])
+	}
+
+	// the NUMA node with the least free devices is preferred
+	ep = deploy(1)
+	assert.Equal(t, "0", ep.NUMANode)
+	assert.Contains(t, ep.GPUMap, "0000:01:00.0")
+
+	// no NUMA node can hold 3 devices
+	ep = deploy(3)
+	assert.Equal(t, "", ep.NUMANode)
+}
+
+func TestCalculateDeployWithVRAM(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-vram", generateGPUMapWithVRAM("nvidia-a10", 2, 0, 24*units.GiB))
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_vram_map": types.VRAMMap{
+			"nvidia-a10": 6 * units.GiB,
+		},
+	}
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, r.Total)
+	assert.InDelta(t, 0.125, r.NodeDeployCapacityMap[node].Rate, 0.0001)
+
+	// the slices are packed on one device
+	d, err := cm.CalculateDeploy(ctx, node, 3, req)
+	assert.Nil(t, err)
+	for i := range d.EnginesParams {
+		ep := &types.EngineParams{}
+		assert.Nil(t, ep.Parse(d.EnginesParams[i]))
+		assert.Equal(t, types.VRAMMap{"0000:00:00.0": 6 * units.GiB}, ep.VRAMMap)
+		assert.Contains(t, ep.GPUMap, "0000:00:00.0")
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[i]))
+		assert.Equal(t, 0, wr.Count())
+		assert.Equal(t, types.VRAMMap{"nvidia-a10": 6 * units.GiB}, wr.ProdVRAMMap)
+	}
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+
+	// the shared device can't be allocated as a whole
+	wholeReq := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-a10": 1,
+		},
+	}
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{node}, wholeReq)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Total)
+	assert.InDelta(t, 0.375, r.NodeDeployCapacityMap[node].Usage, 0.0001)
+	d1, err := cm.CalculateDeploy(ctx, node, 1, wholeReq)
+	assert.Nil(t, err)
+	ep := &types.EngineParams{}
+	assert.Nil(t, ep.Parse(d1.EnginesParams[0]))
+	assert.Contains(t, ep.GPUMap, "0000:01:00.0")
+
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, r.Total)
+
+	// grow a slice
+	r1, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(r1.WorkloadResource))
+	assert.Equal(t, types.VRAMMap{"0000:00:00.0": 12 * units.GiB}, wr.VRAMMap)
+	delta := &types.WorkloadResource{}
+	assert.Nil(t, delta.Parse(r1.DeltaResource))
+	assert.Equal(t, types.VRAMMap{"0000:00:00.0": 6 * units.GiB}, delta.VRAMMap)
+
+	// too large
+	req = plugintypes.WorkloadResourceRequest{
+		"prod_vram_map": types.VRAMMap{
+			"nvidia-a10": 25 * units.GiB,
+		},
+	}
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+}
+
+func TestCalculateDeployWithMIG(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := "test-mig"
+	migMap := types.MIGMap{
+		"MIG-0": {Parent: "0000:00:00.0", Profile: "3g.40gb"},
+		"MIG-1": {Parent: "0000:00:00.0", Profile: "3g.40gb"},
+		"MIG-2": {Parent: "0000:00:00.0", Profile: "1g.10gb"},
+	}
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"gpu_map": generateGPUMap("nvidia-a100", 2, 0),
+		"mig_map": migMap,
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+
+	// the parent GPU isn't a whole GPU
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-a100": 1},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Total)
+
+	req := plugintypes.WorkloadResourceRequest{
+		"profile_count_map": types.ProdCountMap{"3g.40gb": 1},
+	}
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r.Total)
+	assert.InDelta(t, 3.0/7/2, r.NodeDeployCapacityMap[node].Rate, 0.0001)
+
+	_, err = cm.CalculateDeploy(ctx, node, 3, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	uuids := map[string]struct{}{}
+	for i := range d.EnginesParams {
+		ep := &types.EngineParams{}
+		assert.Nil(t, ep.Parse(d.EnginesParams[i]))
+		assert.Len(t, ep.MIGMap, 1)
+		assert.Len(t, ep.GPUMap, 0)
+		for uuid, info := range ep.MIGMap {
+			assert.Equal(t, "3g.40gb", info.Profile)
+			uuids[uuid] = struct{}{}
+		}
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[i]))
+		assert.Equal(t, 0, wr.Count())
+		assert.Len(t, wr.MIGCountMap, 1)
+	}
+	assert.Len(t, uuids, 2)
+
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource[:1], true, true)
+	assert.Nil(t, err)
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Total)
+	assert.InDelta(t, 3.0/7/2, r.NodeDeployCapacityMap[node].Usage, 0.0001)
+
+	nr, err := cm.GetNodeResourceInfo(ctx, node, d.WorkloadsResource[:1])
+	assert.Nil(t, err)
+	assert.Len(t, nr.Diffs, 0)
+}
+
+func TestCalculateDeployWithMinVRAM(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := "test-min-vram"
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 4, "nvidia-a100": 2, "nvidia-h100": 2},
+		"prod_vram":      types.ProdVRAM{"nvidia-3070": 8 * units.GiB, "nvidia-a100": 40 * units.GiB},
+		"gpu_map":        generateGPUMapWithVRAM("nvidia-h100", 2, 0, 80*units.GiB),
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+
+	getCapacity := func(req plugintypes.WorkloadResourceRequest) int {
+		r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+		assert.Nil(t, err)
+		return r.Total
+	}
+	req := plugintypes.WorkloadResourceRequest{
+		"min_vram":       40 * units.GiB,
+		"min_vram_count": 1,
+	}
+	assert.Equal(t, 4, getCapacity(req))
+	assert.Equal(t, 2, getCapacity(plugintypes.WorkloadResourceRequest{
+		"min_vram":       40 * units.GiB,
+		"min_vram_count": 2,
+	}))
+	assert.Equal(t, 1, getCapacity(plugintypes.WorkloadResourceRequest{
+		"min_vram":       80 * units.GiB,
+		"min_vram_count": 2,
+	}))
+	// the h100s are shared by both parts of the request
+	assert.Equal(t, 2, getCapacity(plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-h100": 1},
+		"min_vram":       40 * units.GiB,
+		"min_vram_count": 1,
+	}))
+	assert.Equal(t, 0, getCapacity(plugintypes.WorkloadResourceRequest{
+		"min_vram":       100 * units.GiB,
+		"min_vram_count": 1,
+	}))
+
+	_, err = cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{"min_vram_count": 1})
+	assert.True(t, errors.Is(err, types.ErrInvalidVRAM))
+	_, err = cm.CalculateDeploy(ctx, node, 5, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	// the smaller cards are used first
+	d, err := cm.CalculateDeploy(ctx, node, 3, req)
+	assert.Nil(t, err)
+	prods := []string{}
+	for i := range d.WorkloadsResource {
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[i]))
+		assert.Equal(t, 1, wr.Count())
+		for prod := range wr.ProdCountMap {
+			prods = append(prods, prod)
+		}
+	}
+	assert.Equal(t, []string{"nvidia-a100", "nvidia-a100", "nvidia-h100"}, prods)
+	ep := &types.EngineParams{}
+	assert.Nil(t, ep.Parse(d.EnginesParams[2]))
+	assert.Len(t, ep.GPUMap, 1)
+
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, getCapacity(req))
+
+	// the product of origin is preferred
+	r, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[2], req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(r.WorkloadResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-h100": 2}, wr.ProdCountMap)
+	assert.Len(t, wr.AddrCountMap, 2)
+}
+
+func TestCalculateDeployWithProdPattern(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := "test-prod-pattern"
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 2, "nvidia-3090": 3, "nvidia-a100": 2},
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+
+	getCapacity := func(prodCountMap types.ProdCountMap) int {
+		r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, plugintypes.WorkloadResourceRequest{
+			"prod_count_map": prodCountMap,
+		})
+		assert.Nil(t, err)
+		return r.Total
+	}
+	assert.Equal(t, 7, getCapacity(types.ProdCountMap{"nvidia-*": 1}))
+	assert.Equal(t, 5, getCapacity(types.ProdCountMap{"nvidia-30*": 1}))
+	assert.Equal(t, 2, getCapacity(types.ProdCountMap{"ampere-consumer": 2}))
+	// the 3090s are shared by both parts of the request
+	assert.Equal(t, 2, getCapacity(types.ProdCountMap{"ampere-consumer": 1, "nvidia-3090": 1}))
+	assert.Equal(t, 0, getCapacity(types.ProdCountMap{"amd-*": 1}))
+
+	// the products of alias are tried in order
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"ampere-consumer": 2},
+	}
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	wr0, wr1 := &types.WorkloadResource{}, &types.WorkloadResource{}
+	assert.Nil(t, wr0.Parse(d.WorkloadsResource[0]))
+	assert.Nil(t, wr1.Parse(d.WorkloadsResource[1]))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 2}, wr0.ProdCountMap)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": 2}, wr1.ProdCountMap)
+	_, err = cm.CalculateDeploy(ctx, node, 3, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+
+	// grow and shrink by pattern, the product of origin is kept
+	r, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[1], plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-*": 1},
+	})
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(r.WorkloadResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": 3}, wr.ProdCountMap)
+
+	r, err = cm.CalculateRealloc(ctx, node, d.WorkloadsResource[1], plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"ampere-consumer": -1},
+	})
+	assert.Nil(t, err)
+	wr = &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(r.WorkloadResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": 1}, wr.ProdCountMap)
+	delta := &types.WorkloadResource{}
+	assert.Nil(t, delta.Parse(r.DeltaResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": -1}, delta.ProdCountMap)
+}
+
+func TestCalculateDeployWithAlternatives(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := "test-alternatives"
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-a100": 2, "nvidia-3090": 8},
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+
+	req := plugintypes.WorkloadResourceRequest{
+		"alternatives": []types.ProdCountMap{
+			{"nvidia-a100": 2},
+			{"nvidia-3090": 4},
+		},
+	}
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, r.Total)
+	assert.InDelta(t, 0.4, r.NodeDeployCapacityMap[node].Rate, 0.0001)
+
+	// the first alternative is preferred
+	d, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+	assert.Equal(t, types.ProdCountMap{"nvidia-a100": 2}, wr.ProdCountMap)
+	assert.Equal(t, types.ProdCountMap{"nvidia-a100": 2}, wr.Alternative)
+
+	// the first alternative can't deploy 2 workloads
+	d2, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	for i := range d2.WorkloadsResource {
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d2.WorkloadsResource[i]))
+		assert.Equal(t, types.ProdCountMap{"nvidia-3090": 4}, wr.ProdCountMap)
+		assert.Equal(t, types.ProdCountMap{"nvidia-3090": 4}, wr.Alternative)
+	}
+	_, err = cm.CalculateDeploy(ctx, node, 3, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	// the a100s are used up, so the second alternative is applied to origin
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	rr, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], plugintypes.WorkloadResourceRequest{
+		"alternatives": []types.ProdCountMap{
+			{"nvidia-a100": 1},
+			{"nvidia-3090": 2},
+		},
+	})
+	assert.Nil(t, err)
+	wr = &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(rr.WorkloadResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-a100": 2, "nvidia-3090": 2}, wr.ProdCountMap)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": 2}, wr.Alternative)
+
+	// the alternative of origin is kept by a plain realloc
+	rr, err = cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3090": 1},
+	})
+	assert.Nil(t, err)
+	wr = &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(rr.WorkloadResource))
+	assert.Equal(t, types.ProdCountMap{"nvidia-a100": 2}, wr.Alternative)
+}
+
+func TestCalculateDeployWithCatalog(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{
+		Products: map[string]types.ProductInfo{
+			"nvidia-3070": {Vendor: "nvidia", Arch: "ampere", VRAM: 8 * units.GiB, ComputeCapability: "8.6"},
+			"nvidia-v100": {Vendor: "nvidia", Arch: "volta", VRAM: 32 * units.GiB, ComputeCapability: "7.0"},
+			"nvidia-a100": {Vendor: "nvidia", Arch: "ampere", VRAM: 80 * units.GiB, ComputeCapability: "8.0"},
+		},
+	})
+	node := "test-catalog"
+	// typo
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidai-3070": 2},
+	}, nil)
+	assert.True(t, errors.Is(err, types.ErrInvalidGPUProduct))
+
+	_, err = cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 2, "nvidia-v100": 2, "nvidia-a100": 1},
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, node)
+		assert.NoError(t, err)
+	})
+	_, err = cm.SetNodeResourceCapacity(ctx, node, plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidai-3070": 1},
+	}, nil, true, true)
+	assert.True(t, errors.Is(err, types.ErrInvalidGPUProduct))
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"vendor == nvidia, compute_capability >= 8.0": 2},
+	}
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Total)
+	d, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 2}, wr.ProdCountMap)
+
+	_, err = cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"vendor >= nvidia": 1},
+	})
+	assert.True(t, errors.Is(err, types.ErrInvalidConstraint))
+
+	// the VRAM in catalog is used if the node doesn't know it
+	d, err = cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{
+		"min_vram":       30 * units.GiB,
+		"min_vram_count": 1,
+	})
+	assert.Nil(t, err)
+	wr = &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+	assert.Equal(t, types.ProdCountMap{"nvidia-v100": 1}, wr.ProdCountMap)
 }
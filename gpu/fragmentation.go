@@ -0,0 +1,238 @@
+package gpu
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/utils"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// defaultFragmentationSizes are the numbers of GPUs per request the fragmentation is measured by
+var defaultFragmentationSizes = []int{1, 2, 4, 8}
+
+// AnalyzeFragmentation reports how scattered the free GPUs of each product are across nodes, all the nodes if nodenames is empty,
+// and plans the migrations of workloads to free whole nodes. sizes are the numbers of GPUs per request to measure by.
+// The GPUs reserved by reservations and the deployments in progress are counted as used.
+func (p Plugin) AnalyzeFragmentation(ctx context.Context, nodenames []string, sizes []int) (*gputypes.FragmentationReport, error) {
+	if len(sizes) == 0 {
+		sizes = defaultFragmentationSizes
+	}
+	seen := map[int]bool{}
+	uniqueSizes := []int{}
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, errors.Wrapf(gputypes.ErrInvalidCount, "size(%d) must be positive", size)
+		}
+		if !seen[size] {
+			seen[size] = true
+			uniqueSizes = append(uniqueSizes, size)
+		}
+	}
+	sort.Ints(uniqueSizes)
+
+	if len(nodenames) == 0 {
+		var err error
+		if nodenames, err = p.doListNodenames(ctx); err != nil {
+			return nil, err
+		}
+	}
+	nodesResourceInfo, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.doApplyNodesProvisionals(ctx, nodesResourceInfo); err != nil {
+		return nil, err
+	}
+	if err := p.doApplyReservations(ctx, nodesResourceInfo, "", ""); err != nil {
+		return nil, err
+	}
+
+	prodSet := map[string]bool{}
+	for _, nodeResourceInfo := range nodesResourceInfo {
+		for prod := range nodeResourceInfo.Capacity.ProdCountMap {
+			prodSet[prod] = true
+		}
+	}
+	prods := []string{}
+	for prod := range prodSet {
+		prods = append(prods, prod)
+	}
+	sort.Strings(prods)
+
+	report := &gputypes.FragmentationReport{Products: []*gputypes.ProdFragmentation{}, Diagnostics: diagnostics}
+	for _, prod := range prods {
+		report.Products = append(report.Products, p.doAnalyzeProdFragmentation(nodesResourceInfo, prod, uniqueSizes))
+	}
+	if report.Plan, err = p.doPlanDefrag(ctx, nodesResourceInfo); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (p Plugin) doAnalyzeProdFragmentation(nodesResourceInfo map[string]*gputypes.NodeResourceInfo, prod string, sizes []int) *gputypes.ProdFragmentation {
+	fragmentation := &gputypes.ProdFragmentation{Product: prod, Satisfiable: map[int]int{}}
+	for _, nodeResourceInfo := range nodesResourceInfo {
+		fragmentation.Capacity += nodeResourceInfo.Capacity.ProdCountMap[prod]
+		free := p.freeCount(nodeResourceInfo, nodeResourceInfo.GetAvailableResource(), prod)
+		fragmentation.Free += free
+		fragmentation.LargestFreeBlock = utils.Max(fragmentation.LargestFreeBlock, free)
+		for _, size := range sizes {
+			// the same math as scheduling, so the devices and NUMA nodes are taken into account
+			nodeDeployCapacity, _ := p.doGetNodeDeployCapacity(nodeResourceInfo, &gputypes.WorkloadResourceRequest{ProdCountMap: gputypes.ProdCountMap{prod: size}})
+			fragmentation.Satisfiable[size] += nodeDeployCapacity.Capacity
+		}
+	}
+	if largest := sizes[len(sizes)-1]; fragmentation.Free > 0 {
+		fragmentation.Fragmentation = 1 - float64(fragmentation.Satisfiable[largest]*largest)/float64(fragmentation.Free)
+	}
+	return fragmentation
+}
+
+// doPlanDefrag drains the nodes with the fewest workloads first, the workloads are moved onto the busiest nodes which can hold them,
+// the idle nodes never receive workloads, and the nodes receiving workloads are never drained.
+// A node is only drained if all its usage is held by recorded allocations, and all of them can be moved.
+func (p Plugin) doPlanDefrag(ctx context.Context, nodesResourceInfo map[string]*gputypes.NodeResourceInfo) (*gputypes.DefragPlan, error) {
+	plan := &gputypes.DefragPlan{Migrations: []*gputypes.Migration{}, FreedNodes: []string{}}
+	simulated := map[string]*gputypes.NodeResourceInfo{}
+	nodesAllocations := map[string][]*gputypes.WorkloadResource{}
+	candidates := []string{}
+	for nodename, nodeResourceInfo := range nodesResourceInfo {
+		simulated[nodename] = nodeResourceInfo.DeepCopy()
+		if idle(nodeResourceInfo.Usage) {
+			continue
+		}
+		allocations, err := p.doGetAllocations(ctx, nodename)
+		if err != nil {
+			return nil, err
+		}
+		residual := nodeResourceInfo.Usage.DeepCopy()
+		for _, allocation := range allocations {
+			nodesAllocations[nodename] = append(nodesAllocations[nodename], allocation)
+			residual.Sub(&gputypes.NodeResource{
+				ProdCountMap: allocation.ProdCountMap,
+				AddrCountMap: allocation.AddrCountMap,
+				VRAMMap:      allocation.VRAMMap,
+				MIGCountMap:  allocation.MIGCountMap,
+			})
+		}
+		// the workloads deployed by older versions, the reservations and the deployments in progress can't be moved
+		if idle(residual) {
+			candidates = append(candidates, nodename)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if len(nodesAllocations[ci]) != len(nodesAllocations[cj]) {
+			return len(nodesAllocations[ci]) < len(nodesAllocations[cj])
+		}
+		if ui, uj := nodesResourceInfo[ci].UsageGPUs(), nodesResourceInfo[cj].UsageGPUs(); ui != uj {
+			return ui < uj
+		}
+		return ci < cj
+	})
+
+	receiving := map[string]bool{}
+	for _, candidate := range candidates {
+		if receiving[candidate] {
+			continue
+		}
+		allocations := nodesAllocations[candidate]
+		// the larger workloads are harder to place, so they are placed first
+		sort.Slice(allocations, func(i, j int) bool {
+			if allocations[i].Count() != allocations[j].Count() {
+				return allocations[i].Count() > allocations[j].Count()
+			}
+			return allocations[i].AllocID < allocations[j].AllocID
+		})
+		trial := map[string]*gputypes.NodeResourceInfo{}
+		infoOf := func(nodename string) *gputypes.NodeResourceInfo {
+			if _, ok := trial[nodename]; !ok {
+				trial[nodename] = simulated[nodename].DeepCopy()
+			}
+			return trial[nodename]
+		}
+		migrations := []*gputypes.Migration{}
+		for _, allocation := range allocations {
+			to := p.doPlaceMigration(candidate, allocation, simulated, infoOf)
+			if to == "" {
+				migrations = nil
+				break
+			}
+			migrations = append(migrations, &gputypes.Migration{AllocID: allocation.AllocID, From: candidate, To: to, ProdCountMap: allocation.ProdCountMap.DeepCopy()})
+		}
+		if migrations == nil {
+			continue
+		}
+		for nodename, nodeResourceInfo := range trial {
+			simulated[nodename] = nodeResourceInfo
+		}
+		simulated[candidate].Usage = gputypes.NewNodeResource(nil, nil, nil, nil, nil)
+		for _, migration := range migrations {
+			receiving[migration.To] = true
+		}
+		plan.Migrations = append(plan.Migrations, migrations...)
+		plan.FreedNodes = append(plan.FreedNodes, candidate)
+	}
+	return plan, nil
+}
+
+// doPlaceMigration returns the node the allocation is moved to, empty if no node can hold it,
+// the node with the least free GPUs is preferred in order to keep the larger blocks.
+func (p Plugin) doPlaceMigration(from string, allocation *gputypes.WorkloadResource, simulated map[string]*gputypes.NodeResourceInfo, infoOf func(string) *gputypes.NodeResourceInfo) string {
+	targets := []string{}
+	for nodename, nodeResourceInfo := range simulated {
+		if nodename != from && !idle(nodeResourceInfo.Usage) {
+			targets = append(targets, nodename)
+		}
+	}
+	free := map[string]int{}
+	for _, nodename := range targets {
+		free[nodename] = infoOf(nodename).GetAvailableResource().Count()
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if free[targets[i]] != free[targets[j]] {
+			return free[targets[i]] < free[targets[j]]
+		}
+		return targets[i] < targets[j]
+	})
+	req := &gputypes.WorkloadResourceRequest{
+		ProdCountMap:    allocation.ProdCountMap.DeepCopy(),
+		ProdVRAMMap:     allocation.ProdVRAMMap.DeepCopy(),
+		ProfileCountMap: allocation.ProfileCountMap.DeepCopy(),
+	}
+	for _, nodename := range targets {
+		nodeResourceInfo := infoOf(nodename)
+		if _, workloadsResource, err := p.doAlloc(nodeResourceInfo, 1, req, nil); err == nil {
+			nodeResourceInfo.Usage = p.incrUpdateNodeResource(nil, nil, nodeResourceInfo.Usage, workloadsResource, true)
+			return nodename
+		}
+	}
+	return ""
+}
+
+// idle returns true if the usage holds nothing
+func idle(usage *gputypes.NodeResource) bool {
+	for _, count := range usage.ProdCountMap {
+		if count > 0 {
+			return false
+		}
+	}
+	for _, count := range usage.AddrCountMap {
+		if count > 0 {
+			return false
+		}
+	}
+	for _, vram := range usage.VRAMMap {
+		if vram > 0 {
+			return false
+		}
+	}
+	for _, count := range usage.MIGCountMap {
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
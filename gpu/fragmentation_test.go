@@ -0,0 +1,68 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestFragmentation(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	nodenames := []string{}
+	for _, name := range []string{"frag-1", "frag-2", "frag-3", "frag-4"} {
+		nodenames = append(nodenames, generateNodeWithGPUMap(ctx, t, cm, name, generateGPUMap("nvidia-3070", 8, 0)))
+	}
+	deploy := func(node string, deployCount, count int) []string {
+		d, err := cm.CalculateDeploy(ctx, node, deployCount, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": count}})
+		assert.Nil(t, err)
+		_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+		assert.Nil(t, err)
+		allocIDs := []string{}
+		for _, raw := range d.WorkloadsResource {
+			wr := &types.WorkloadResource{}
+			assert.Nil(t, wr.Parse(raw))
+			allocIDs = append(allocIDs, wr.AllocID)
+		}
+		return allocIDs
+	}
+	small := deploy("frag-1", 2, 2)
+	deploy("frag-2", 1, 6)
+	tiny := deploy("frag-3", 1, 1)
+	// the workload deployed by older versions has no record, so its node can't be drained
+	_, err := cm.SetNodeResourceUsage(ctx, "frag-4", nil, nil, []plugintypes.WorkloadResource{{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}}}, true, true)
+	assert.Nil(t, err)
+
+	_, err = cm.AnalyzeFragmentation(ctx, nodenames, []int{0})
+	assert.ErrorIs(t, err, types.ErrInvalidCount)
+
+	report, err := cm.AnalyzeFragmentation(ctx, nil, []int{8, 4, 2, 1, 4})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ProdFragmentation{{
+		Product:          "nvidia-3070",
+		Capacity:         32,
+		Free:             20,
+		LargestFreeBlock: 7,
+		Satisfiable:      map[int]int{1: 20, 2: 9, 4: 3, 8: 0},
+		Fragmentation:    1,
+	}}, report.Products)
+
+	// the tiny one fits the busiest node, then the small ones are moved onto the node which can't be drained
+	assert.Equal(t, []string{"frag-3", "frag-1"}, report.Plan.FreedNodes)
+	assert.Equal(t, 3, len(report.Plan.Migrations))
+	assert.Equal(t, &types.Migration{AllocID: tiny[0], From: "frag-3", To: "frag-2", ProdCountMap: types.ProdCountMap{"nvidia-3070": 1}}, report.Plan.Migrations[0])
+	for _, migration := range report.Plan.Migrations[1:] {
+		assert.Contains(t, small, migration.AllocID)
+		assert.Equal(t, "frag-4", migration.To)
+	}
+
+	// the node receiving workloads is not drained
+	report, err = cm.AnalyzeFragmentation(ctx, []string{"frag-1", "frag-3"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"frag-3"}, report.Plan.FreedNodes)
+	assert.Equal(t, "frag-1", report.Plan.Migrations[0].To)
+	assert.Equal(t, 4, len(report.Products[0].Satisfiable))
+}
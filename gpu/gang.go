@@ -0,0 +1,206 @@
+package gpu
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/log"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/projecteru2/core/utils"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// CalculateGang plans all the members of a gang across nodes, or nothing if they can't all fit.
+// If groupBy is set, all the members are kept on the nodes sharing the same value of the label, e.g. rack or zone.
+// The members are packed onto as few nodes as possible, and the group needing the fewest nodes is chosen.
+// The GPUs planned are reserved like CalculateDeploy if provisional TTL is set, all of them or none.
+func (p Plugin) CalculateGang(
+	ctx context.Context, nodenames []string, members int,
+	resourceRequest plugintypes.WorkloadResourceRequest, groupBy string,
+) (
+	*gputypes.GangPlan, error,
+) {
+	logger := log.WithFunc("resource.gpu.CalculateGang")
+	if members <= 0 {
+		return nil, errors.Wrapf(gputypes.ErrInvalidGang, "members(%d) must be positive", members)
+	}
+	req := &gputypes.WorkloadResourceRequest{}
+	if err := req.Parse(resourceRequest); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		logger.Errorf(ctx, err, "invalid resource opts %+v", req)
+		return nil, err
+	}
+
+	// the plan is recalculated if the GPUs were taken by other deployments meanwhile
+	for i := 0; i < maxCASRetries; i++ {
+		nodeCountMap, group, err := p.doPlanGang(ctx, nodenames, members, req, groupBy)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+		plan, err := p.doCalculateGang(ctx, nodeCountMap, req)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+		if plan != nil {
+			plan.Members = members
+			plan.Group = group
+			return plan, nil
+		}
+	}
+	return nil, errors.Wrapf(gputypes.ErrConflict, "gang of %d members, retried %d times", members, maxCASRetries)
+}
+
+// doPlanGang returns the number of members on each node and the group they are in
+func (p Plugin) doPlanGang(ctx context.Context, nodenames []string, members int, req *gputypes.WorkloadResourceRequest, groupBy string) (map[string]int, string, error) {
+	nodesResourceInfo, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := p.checkDiagnostics(ctx, diagnostics, false); err != nil {
+		return nil, "", err
+	}
+	if err := p.doApplyNodesProvisionals(ctx, nodesResourceInfo); err != nil {
+		return nil, "", err
+	}
+	if err := p.doApplyReservations(ctx, nodesResourceInfo, req.ReservationID, req.Tenant); err != nil {
+		return nil, "", err
+	}
+
+	groups := map[string][]string{}
+	if groupBy == "" {
+		for nodename := range nodesResourceInfo {
+			groups[""] = append(groups[""], nodename)
+		}
+	} else {
+		nodesLabels, err := p.doGetNodesLabels(ctx, nodenames)
+		if err != nil {
+			return nil, "", err
+		}
+		// the nodes without the label can't be in any group
+		for nodename := range nodesResourceInfo {
+			if value, ok := nodesLabels[nodename][groupBy]; ok {
+				groups[value] = append(groups[value], nodename)
+			}
+		}
+	}
+	capacity := map[string]int{}
+	for nodename, nodeResourceInfo := range nodesResourceInfo {
+		nodeDeployCapacity, _ := p.doGetNodeDeployCapacity(nodeResourceInfo, req)
+		capacity[nodename] = nodeDeployCapacity.Capacity
+	}
+
+	values := make([]string, 0, len(groups))
+	for value := range groups {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	var best map[string]int
+	var bestGroup string
+	most := 0
+	for _, value := range values {
+		group := groups[value]
+		sort.Slice(group, func(i, j int) bool {
+			if capacity[group[i]] != capacity[group[j]] {
+				return capacity[group[i]] > capacity[group[j]]
+			}
+			return group[i] < group[j]
+		})
+		nodeCountMap := map[string]int{}
+		need := members
+		for _, nodename := range group {
+			if need == 0 || capacity[nodename] <= 0 {
+				break
+			}
+			count := utils.Min(need, capacity[nodename])
+			nodeCountMap[nodename] = count
+			need -= count
+		}
+		most = utils.Max(most, members-need)
+		if need == 0 && (best == nil || len(nodeCountMap) < len(best)) {
+			best, bestGroup = nodeCountMap, value
+		}
+	}
+	if best == nil {
+		if groupBy != "" {
+			return nil, "", errors.Wrapf(coretypes.ErrInsufficientResource, "gang of %d members: at most %d fit in a group of %s", members, most, groupBy)
+		}
+		return nil, "", errors.Wrapf(coretypes.ErrInsufficientResource, "gang of %d members: at most %d fit", members, most)
+	}
+	return best, bestGroup, nil
+}
+
+// doCalculateGang plans the members on each node, nil will be returned if any node can't hold its members any more
+func (p Plugin) doCalculateGang(ctx context.Context, nodeCountMap map[string]int, req *gputypes.WorkloadResourceRequest) (*gputypes.GangPlan, error) {
+	nodenames := make([]string, 0, len(nodeCountMap))
+	for nodename := range nodeCountMap {
+		nodenames = append(nodenames, nodename)
+	}
+	sort.Strings(nodenames)
+
+	enginesParams := map[string][]*gputypes.EngineParams{}
+	workloadsResource := map[string][]*gputypes.WorkloadResource{}
+	revisions := map[string]int64{}
+	incr := gputypes.ProdCountMap{}
+	for _, nodename := range nodenames {
+		nodeResourceInfo, revision, err := p.doGetNodeResourceInfoWithProvisionals(ctx, nodename)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.doApplyReservations(ctx, map[string]*gputypes.NodeResourceInfo{nodename: nodeResourceInfo}, req.ReservationID, req.Tenant); err != nil {
+			return nil, err
+		}
+		eps, wrs, err := p.doCalculateDeploy(nodename, nodeResourceInfo, nodeCountMap[nodename], req)
+		if errors.Is(err, coretypes.ErrInsufficientResource) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		enginesParams[nodename], workloadsResource[nodename], revisions[nodename] = eps, wrs, revision
+		for _, wr := range wrs {
+			incr.Add(wr.ProdCountMap)
+		}
+	}
+
+	reserved := []string{}
+	release := func() {
+		for _, nodename := range reserved {
+			if err := p.doConfirmProvisionals(ctx, nodename, workloadsResource[nodename]); err != nil {
+				log.WithFunc("resource.gpu.doCalculateGang").Warnf(ctx, "failed to release reservations on %s: %+v", nodename, err)
+			}
+		}
+	}
+	if p.provisionalEnabled() {
+		for _, nodename := range nodenames {
+			ok, err := p.doReserveProvisionals(ctx, nodename, workloadsResource[nodename], revisions[nodename])
+			if err != nil || !ok {
+				release()
+				return nil, err
+			}
+			reserved = append(reserved, nodename)
+		}
+	}
+	held := []*gputypes.WorkloadResource{}
+	for _, nodename := range reserved {
+		held = append(held, workloadsResource[nodename]...)
+	}
+	if err := p.checkQuota(ctx, req.Tenant, incr, held); err != nil {
+		release()
+		return nil, err
+	}
+
+	plan := &gputypes.GangPlan{
+		NodeCountMap: nodeCountMap,
+		Nodes:        map[string]*plugintypes.CalculateDeployResponse{},
+	}
+	for _, nodename := range nodenames {
+		plan.Nodes[nodename] = p.deployResponse(enginesParams[nodename], workloadsResource[nodename])
+	}
+	return plan, nil
+}
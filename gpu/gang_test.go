@@ -0,0 +1,75 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestGang(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{Provisional: types.ProvisionalConfig{TTL: time.Minute}})
+
+	// the labels can be set when the node is added
+	_, err := cm.AddNode(ctx, "gang-1", plugintypes.NodeResourceRequest{
+		"gpu_map": generateGPUMap("nvidia-3070", 8, 0),
+		"labels":  types.NodeLabels{"rack": "r1"},
+	}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _, _ = cm.RemoveNode(ctx, "gang-1") })
+	nodenames := []string{"gang-1"}
+	for _, node := range []struct {
+		name  string
+		count int
+		rack  string
+	}{{"gang-2", 8, "r1"}, {"gang-3", 8, "r2"}, {"gang-4", 4, "r2"}} {
+		nodenames = append(nodenames, generateNodeWithGPUMap(ctx, t, cm, node.name, generateGPUMap("nvidia-3070", node.count, 0)))
+		assert.Nil(t, cm.SetNodeLabels(ctx, node.name, types.NodeLabels{"rack": node.rack}))
+	}
+	labels, err := cm.GetNodeLabels(ctx, "gang-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.NodeLabels{"rack": "r1"}, labels)
+	assert.ErrorIs(t, cm.SetNodeLabels(ctx, "gang-1", types.NodeLabels{"": "r1"}), types.ErrInvalidGang)
+
+	full := plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 8}}
+	_, err = cm.CalculateGang(ctx, nodenames, 0, full, "")
+	assert.ErrorIs(t, err, types.ErrInvalidGang)
+
+	// 3 full nodes are only available across racks
+	_, err = cm.CalculateGang(ctx, nodenames, 3, full, "rack")
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+
+	// the members are packed onto the fewest nodes
+	half := plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 4}}
+	plan, err := cm.CalculateGang(ctx, nodenames, 4, half, "rack")
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", plan.Group)
+	assert.Equal(t, map[string]int{"gang-1": 2, "gang-2": 2}, plan.NodeCountMap)
+	assert.Equal(t, 2, len(plan.Nodes["gang-1"].WorkloadsResource))
+	assert.Equal(t, 2, len(plan.Nodes["gang-2"].EnginesParams))
+
+	// rack r1 is reserved by the gang, all or nothing of the next gang
+	_, err = cm.CalculateGang(ctx, nodenames, 2, full, "rack")
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+	capacity, err := cm.GetNodesDeployCapacity(ctx, nodenames, half)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, capacity.Total)
+
+	plan, err = cm.CalculateGang(ctx, nodenames, 3, half, "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"gang-3": 2, "gang-4": 1}, plan.NodeCountMap)
+	_, err = cm.CalculateGang(ctx, nodenames, 1, half, "")
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+
+	// the labels are removed with the node
+	_, err = cm.RemoveNode(ctx, "gang-1")
+	assert.Nil(t, err)
+	labels, err = cm.GetNodeLabels(ctx, "gang-1")
+	assert.Nil(t, err)
+	assert.Empty(t, labels)
+}
@@ -2,39 +2,86 @@ package gpu
 
 import (
 	"context"
-	"testing"
 
 	"github.com/projecteru2/core/log"
-	"github.com/projecteru2/core/store/etcdv3/meta"
 	coretypes "github.com/projecteru2/core/types"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 )
 
 const (
-	name                = "gpu"
-	rate                = 8
-	nodeResourceInfoKey = "/resource/gpu/%s"
-	priority            = 100
+	name                   = "gpu"
+	rate                   = 8
+	nodeResourceInfoPrefix = "/resource/gpu/"
+	nodeResourceInfoKey    = nodeResourceInfoPrefix + "%s"
+	allocationRoot         = "/resource/gpu-allocation/"
+	allocationPrefix       = allocationRoot + "%s/"
+	allocationKey          = allocationPrefix + "%s"
+	allocIDLength          = 16
+	historyPrefix          = "/resource/gpu-history/%s/"
+	historyKey             = historyPrefix + "%020d"
+	provisionalRoot        = "/resource/gpu-provisional/"
+	provisionalPrefix      = provisionalRoot + "%s/"
+	provisionalKey         = provisionalPrefix + "%s"
+	provisionalSeqKey      = "/resource/gpu-provisional-seq/%s"
+	reservationsKey        = "/resource/gpu-reservations"
+	reservationIDLength    = 16
+	quotasKey              = "/resource/gpu-quotas"
+	tenantUsageRoot        = "/resource/gpu-tenant-usage/"
+	tenantUsageKey         = tenantUsageRoot + "%s"
+	nodeLabelsKey          = "/resource/gpu-labels/%s"
+	// maxPriority is the priority of GetMostIdleNode when the node chosen is totally idle
+	maxPriority = 100
+	// maxCASRetries bounds the retries of read-modify-write on node resource info
+	maxCASRetries = 32
 )
 
 // Plugin
 type Plugin struct {
-	name   string
-	config coretypes.Config
-	store  meta.KV
+	name      string
+	config    coretypes.Config
+	gpuConfig *gputypes.Config
+	store     store.Store
 }
 
 // NewPlugin .
-func NewPlugin(ctx context.Context, config coretypes.Config, t *testing.T) (*Plugin, error) {
-	if t == nil && len(config.Etcd.Machines) < 1 {
-		return nil, coretypes.ErrConfigInvaild
+func NewPlugin(ctx context.Context, config coretypes.Config, gpuConfig *gputypes.Config) (*Plugin, error) {
+	if gpuConfig == nil {
+		gpuConfig = &gputypes.Config{}
 	}
-	var err error
-	plugin := &Plugin{name: name, config: config}
-	if plugin.store, err = meta.NewETCD(config.Etcd, t); err != nil {
+	if err := gpuConfig.Validate(); err != nil {
+		return nil, err
+	}
+	s, err := newStore(config, gpuConfig.Storage)
+	if err != nil {
 		log.WithFunc("resource.gpu.NewPlugin").Error(ctx, err)
 		return nil, err
 	}
-	return plugin, nil
+	return &Plugin{name: name, config: config, gpuConfig: gpuConfig, store: s}, nil
+}
+
+// NewPluginWithStore creates the plugin on the store given instead of the storage of config,
+// e.g. an embedded etcd in tests
+func NewPluginWithStore(config coretypes.Config, gpuConfig *gputypes.Config, s store.Store) (*Plugin, error) {
+	if gpuConfig == nil {
+		gpuConfig = &gputypes.Config{}
+	}
+	if err := gpuConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return &Plugin{name: name, config: config, gpuConfig: gpuConfig, store: s}, nil
+}
+
+// newStore creates the store by the storage config
+func newStore(config coretypes.Config, storageConfig gputypes.StorageConfig) (store.Store, error) {
+	switch storageConfig.Type {
+	case gputypes.StorageMemory:
+		return store.NewMemory(), nil
+	case gputypes.StorageFile:
+		return store.NewFile(storageConfig.Path)
+	default:
+		return store.NewETCD(config.Etcd)
+	}
 }
 
 // Name .
@@ -3,12 +3,14 @@ package gpu
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	enginetypes "github.com/projecteru2/core/engine/types"
 	plugintypes "github.com/projecteru2/core/resource/plugins/types"
 	coretypes "github.com/projecteru2/core/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/store/storetest"
 	"github.com/yuyang0/resource-gpu/gpu/types"
 )
 
@@ -17,7 +19,44 @@ func TestName(t *testing.T) {
 	assert.Equal(t, cm.name, cm.Name())
 }
 
+func TestNewPluginWithStorage(t *testing.T) {
+	ctx := context.Background()
+	config := coretypes.Config{}
+
+	// etcd needs machines
+	_, err := NewPlugin(ctx, config, nil)
+	assert.ErrorIs(t, err, coretypes.ErrConfigInvaild)
+
+	cm, err := NewPlugin(ctx, config, &types.Config{Storage: types.StorageConfig{Type: types.StorageMemory}})
+	assert.Nil(t, err)
+	generateNodes(ctx, t, cm, 1, 0)
+
+	// the nodes are kept across plugins with file storage
+	gpuConfig := &types.Config{Storage: types.StorageConfig{Type: types.StorageFile, Path: filepath.Join(t.TempDir(), "gpu.db")}}
+	cm, err = NewPlugin(ctx, config, gpuConfig)
+	assert.Nil(t, err)
+	for name, req := range generateNodeResourceRequests(t, 1, 0, "test", 8) {
+		_, err = cm.AddNode(ctx, name, req, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, cm.store.Close())
+
+		cm, err = NewPlugin(ctx, config, gpuConfig)
+		assert.Nil(t, err)
+		_, err = cm.GetNodeResourceInfo(ctx, name, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, cm.store.Close())
+	}
+}
+
 func initGPU(ctx context.Context, t *testing.T) *Plugin {
+	return initGPUWithConfig(ctx, t, &types.Config{
+		Aliases: map[string][]string{
+			"ampere-consumer": {"nvidia-3070", "nvidia-3080", "nvidia-3090"},
+		},
+	})
+}
+
+func initGPUWithConfig(ctx context.Context, t *testing.T, gpuConfig *types.Config) *Plugin {
 	config := coretypes.Config{
 		Etcd: coretypes.EtcdConfig{
 			Prefix: "/gpu",
@@ -28,7 +67,7 @@ func initGPU(ctx context.Context, t *testing.T) *Plugin {
 		},
 	}
 
-	cm, err := NewPlugin(ctx, config, t)
+	cm, err := NewPluginWithStore(config, gpuConfig, storetest.NewETCD(t, config.Etcd.Prefix))
 	assert.NoError(t, err)
 	return cm
 }
@@ -96,3 +135,35 @@ func generateNodeResourceRequests(t *testing.T, nums int, index int, namePrefix
 	}
 	return infos
 }
+
+func generateGPUMap(prod string, nums int, index int) types.GPUMap {
+	return generateGPUMapWithVRAM(prod, nums, index, 0)
+}
+
+func generateGPUMapWithVRAM(prod string, nums int, index int, vram int64) types.GPUMap {
+	gpuMap := types.GPUMap{}
+	for i := index; i < index+nums; i++ {
+		addr := fmt.Sprintf("0000:%02x:00.0", i)
+		gpuMap[addr] = types.GPUInfo{
+			Address: addr,
+			Index:   i,
+			UUID:    fmt.Sprintf("GPU-%s-%d", prod, i),
+			Product: prod,
+			VRAM:    vram,
+		}
+	}
+	return gpuMap
+}
+
+func generateNodeWithGPUMap(ctx context.Context, t *testing.T, cm *Plugin, name string, gpuMap types.GPUMap) string {
+	req := plugintypes.NodeResourceRequest{
+		"gpu_map": gpuMap,
+	}
+	_, err := cm.AddNode(ctx, name, req, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := cm.RemoveNode(ctx, name)
+		assert.NoError(t, err)
+	})
+	return name
+}
@@ -0,0 +1,108 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/log"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+type reasonKey struct{}
+
+// WithReason attaches the reason of a change to ctx, it's recorded in the history of node
+func WithReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, reasonKey{}, reason)
+}
+
+func reasonOf(ctx context.Context) string {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return reason
+}
+
+// GetNodeResourceHistory returns the history records of node in [from, to], sorted by time,
+// zero from or to means no limit.
+func (p Plugin) GetNodeResourceHistory(ctx context.Context, nodename string, from, to time.Time) ([]*gputypes.HistoryRecord, error) {
+	kvs, err := p.store.GetPrefix(ctx, fmt.Sprintf(historyPrefix, nodename))
+	if err != nil {
+		return nil, err
+	}
+	records := []*gputypes.HistoryRecord{}
+	for _, kv := range kvs {
+		record := &gputypes.HistoryRecord{}
+		if err := json.Unmarshal(kv.Value, record); err != nil {
+			return nil, err
+		}
+		if (!from.IsZero() && record.Time.Before(from)) || (!to.IsZero() && record.Time.After(to)) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// appendHistory records a change of node, the failure is only logged because the change has been made
+func (p Plugin) appendHistory(ctx context.Context, nodename, op string, delta, incr bool, before, after *gputypes.NodeResource) {
+	record := &gputypes.HistoryRecord{
+		Time:      time.Now(),
+		Operation: op,
+		Delta:     delta,
+		Incr:      incr,
+		Before:    before,
+		After:     after,
+		Reason:    reasonOf(ctx),
+	}
+	if err := p.doAppendHistory(ctx, nodename, record); err != nil {
+		log.WithFunc("resource.gpu.appendHistory").WithField("node", nodename).Error(ctx, err, "failed to append history")
+	}
+}
+
+func (p Plugin) doAppendHistory(ctx context.Context, nodename string, record *gputypes.HistoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// the records are keyed by time, try the next nanosecond if there is already one
+	ts := record.Time.UnixNano()
+	for i := 0; i < maxCASRetries; i++ {
+		ok, err := p.store.CompareAndSwap(ctx, fmt.Sprintf(historyKey, nodename, ts+int64(i)), string(data), 0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return p.doTrimHistory(ctx, nodename)
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "history of node: %s, retried %d times", nodename, maxCASRetries)
+}
+
+// doTrimHistory drops the oldest records beyond the limit
+func (p Plugin) doTrimHistory(ctx context.Context, nodename string) error {
+	kvs, err := p.store.GetPrefix(ctx, fmt.Sprintf(historyPrefix, nodename))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(kvs)-p.gpuConfig.MaxHistoryRecords(); i++ {
+		if err := p.store.Delete(ctx, kvs[i].Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doRemoveHistory removes all the records of node
+func (p Plugin) doRemoveHistory(ctx context.Context, nodename string) error {
+	kvs, err := p.store.GetPrefix(ctx, fmt.Sprintf(historyPrefix, nodename))
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if err := p.store.Delete(ctx, kv.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
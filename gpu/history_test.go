@@ -0,0 +1,80 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestNodeResourceHistory(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{History: types.HistoryConfig{MaxRecords: 3}})
+	nodes := generateNodes(ctx, t, cm, 1, 0)
+	node := nodes[0]
+
+	records, err := cm.GetNodeResourceHistory(ctx, node, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+
+	workloadsResource := []plugintypes.WorkloadResource{
+		{
+			"prod_count_map": types.ProdCountMap{
+				"nvidia-3070": 1,
+			},
+		},
+	}
+	start := time.Now()
+	_, err = cm.SetNodeResourceUsage(WithReason(ctx, "deploy"), node, nil, nil, workloadsResource, true, true)
+	assert.Nil(t, err)
+	records, err = cm.GetNodeResourceHistory(ctx, node, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, types.OpSetUsage, records[0].Operation)
+	assert.True(t, records[0].Delta)
+	assert.True(t, records[0].Incr)
+	assert.Equal(t, "deploy", records[0].Reason)
+	assert.Equal(t, 0, records[0].Before.Count())
+	assert.Equal(t, 1, records[0].After.Count())
+
+	capacity := plugintypes.NodeResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 2,
+		},
+	}
+	_, err = cm.SetNodeResourceCapacity(ctx, node, capacity, nil, true, true)
+	assert.Nil(t, err)
+	// the usage doesn't match any workload
+	_, err = cm.FixNodeResource(WithReason(ctx, "leak"), node, nil)
+	assert.Nil(t, err)
+	records, err = cm.GetNodeResourceHistory(ctx, node, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, types.OpSetCapacity, records[1].Operation)
+	assert.Equal(t, types.OpFix, records[2].Operation)
+	assert.Equal(t, "leak", records[2].Reason)
+	assert.Equal(t, 1, records[2].Before.Count())
+	assert.Equal(t, 0, records[2].After.Count())
+
+	// the oldest records are dropped
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, workloadsResource, true, true)
+	assert.Nil(t, err)
+	records, err = cm.GetNodeResourceHistory(ctx, node, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, types.OpSetCapacity, records[0].Operation)
+
+	// query by time range
+	records, err = cm.GetNodeResourceHistory(ctx, node, start, time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	records, err = cm.GetNodeResourceHistory(ctx, node, time.Now(), time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+	records, err = cm.GetNodeResourceHistory(ctx, node, time.Time{}, start)
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+}
@@ -0,0 +1,69 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/utils"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// SetNodeLabels replaces the labels of node, e.g. the rack or zone it's in
+func (p Plugin) SetNodeLabels(ctx context.Context, nodename string, labels gputypes.NodeLabels) error {
+	if err := labels.Validate(); err != nil {
+		return err
+	}
+	if _, err := p.doGetNodeResourceInfo(ctx, nodename); err != nil {
+		return err
+	}
+	return p.doSetNodeLabels(ctx, nodename, labels)
+}
+
+// GetNodeLabels returns the labels of node, empty if it has none
+func (p Plugin) GetNodeLabels(ctx context.Context, nodename string) (gputypes.NodeLabels, error) {
+	labels := gputypes.NodeLabels{}
+	kv, err := p.store.Get(ctx, fmt.Sprintf(nodeLabelsKey, nodename))
+	if errors.Is(err, store.ErrKeyNotExists) {
+		return labels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return labels, json.Unmarshal(kv.Value, &labels)
+}
+
+func (p Plugin) doSetNodeLabels(ctx context.Context, nodename string, labels gputypes.NodeLabels) error {
+	key := fmt.Sprintf(nodeLabelsKey, nodename)
+	if len(labels) == 0 {
+		return p.store.Delete(ctx, key)
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	return p.store.Put(ctx, key, string(data))
+}
+
+// doGetNodesLabels returns the labels by node, the nodes without labels are left out
+func (p Plugin) doGetNodesLabels(ctx context.Context, nodenames []string) (map[string]gputypes.NodeLabels, error) {
+	keys := make([]string, 0, len(nodenames))
+	for _, nodename := range nodenames {
+		keys = append(keys, fmt.Sprintf(nodeLabelsKey, nodename))
+	}
+	kvs, err := p.store.GetMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	nodesLabels := map[string]gputypes.NodeLabels{}
+	for _, kv := range kvs {
+		labels := gputypes.NodeLabels{}
+		if err := json.Unmarshal(kv.Value, &labels); err != nil {
+			return nil, errors.Wrapf(err, "key: %s", kv.Key)
+		}
+		nodesLabels[utils.Tail(kv.Key)] = labels
+	}
+	return nodesLabels, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/mitchellh/mapstructure"
 	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 )
 
 // GetMetricsDescription .
@@ -21,10 +22,34 @@ func (p Plugin) GetMetricsDescription(context.Context) (*plugintypes.GetMetricsD
 		},
 		{
 			"name":   "gpu_used",
-			"help":   "node used gpu.",
+			"help":   "node used gpu, shared gpu is counted by the proportion of vram in use.",
 			"type":   "gauge",
 			"labels": []string{"podname", "nodename", "product"},
 		},
+		{
+			"name":   "gpu_vram_capacity",
+			"help":   "node available gpu vram.",
+			"type":   "gauge",
+			"labels": []string{"podname", "nodename", "product"},
+		},
+		{
+			"name":   "gpu_vram_used",
+			"help":   "node used gpu vram.",
+			"type":   "gauge",
+			"labels": []string{"podname", "nodename", "product"},
+		},
+		{
+			"name":   "gpu_mig_capacity",
+			"help":   "node available gpu mig instances.",
+			"type":   "gauge",
+			"labels": []string{"podname", "nodename", "profile"},
+		},
+		{
+			"name":   "gpu_mig_used",
+			"help":   "node used gpu mig instances.",
+			"type":   "gauge",
+			"labels": []string{"podname", "nodename", "profile"},
+		},
 	}, resp)
 }
 
@@ -35,6 +60,22 @@ func (p Plugin) GetMetrics(ctx context.Context, podname, nodename string) (*plug
 		return nil, err
 	}
 	safeNodename := strings.ReplaceAll(nodename, ".", "_")
+
+	// the VRAM of the held devices and the shared slices
+	vramCapacity := map[string]int64{}
+	vramUsed := map[string]int64{}
+	sharedUsed := map[string]float64{}
+	for addr, info := range nodeResourceInfo.Capacity.GPUMap {
+		vramCapacity[info.Product] += info.VRAM
+		if _, ok := nodeResourceInfo.Usage.AddrCountMap[addr]; ok {
+			vramUsed[info.Product] += info.VRAM
+		}
+		if vram, ok := nodeResourceInfo.Usage.VRAMMap[addr]; ok && info.VRAM > 0 {
+			vramUsed[info.Product] += vram
+			sharedUsed[info.Product] += float64(vram) / float64(info.VRAM)
+		}
+	}
+
 	var metrics []map[string]any
 	for prod, count := range nodeResourceInfo.Capacity.ProdCountMap {
 		metrics = append(metrics, map[string]any{
@@ -43,13 +84,49 @@ func (p Plugin) GetMetrics(ctx context.Context, podname, nodename string) (*plug
 			"value":  fmt.Sprintf("%+v", count),
 			"key":    fmt.Sprintf("core.node.%s.gpu.capacity", safeNodename),
 		})
-		usageCount := nodeResourceInfo.Usage.ProdCountMap[prod]
+		usageCount := float64(nodeResourceInfo.Usage.ProdCountMap[prod]) + sharedUsed[prod]
 		metrics = append(metrics, map[string]any{
 			"name":   "gpu_used",
 			"labels": []string{podname, nodename, prod},
 			"value":  fmt.Sprintf("%+v", usageCount),
 			"key":    fmt.Sprintf("core.node.%s.gpu.used", safeNodename),
 		})
+		if vramCapacity[prod] == 0 {
+			continue
+		}
+		metrics = append(metrics, map[string]any{
+			"name":   "gpu_vram_capacity",
+			"labels": []string{podname, nodename, prod},
+			"value":  fmt.Sprintf("%+v", vramCapacity[prod]),
+			"key":    fmt.Sprintf("core.node.%s.gpu.vram.capacity", safeNodename),
+		})
+		metrics = append(metrics, map[string]any{
+			"name":   "gpu_vram_used",
+			"labels": []string{podname, nodename, prod},
+			"value":  fmt.Sprintf("%+v", vramUsed[prod]),
+			"key":    fmt.Sprintf("core.node.%s.gpu.vram.used", safeNodename),
+		})
+	}
+
+	migUsed := gputypes.ProdCountMap{}
+	for uuid := range nodeResourceInfo.Usage.MIGCountMap {
+		if info, ok := nodeResourceInfo.Capacity.MIGMap[uuid]; ok {
+			migUsed[info.Profile]++
+		}
+	}
+	for profile, count := range nodeResourceInfo.Capacity.MIGMap.ProfileCountMap() {
+		metrics = append(metrics, map[string]any{
+			"name":   "gpu_mig_capacity",
+			"labels": []string{podname, nodename, profile},
+			"value":  fmt.Sprintf("%+v", count),
+			"key":    fmt.Sprintf("core.node.%s.gpu.mig.capacity", safeNodename),
+		})
+		metrics = append(metrics, map[string]any{
+			"name":   "gpu_mig_used",
+			"labels": []string{podname, nodename, profile},
+			"value":  fmt.Sprintf("%+v", migUsed[profile]),
+			"key":    fmt.Sprintf("core.node.%s.gpu.mig.used", safeNodename),
+		})
 	}
 
 	resp := &plugintypes.GetMetricsResponse{}
@@ -2,9 +2,13 @@ package gpu
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/docker/go-units"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
 )
 
 func TestGetMetricsDescription(t *testing.T) {
@@ -13,7 +17,7 @@ func TestGetMetricsDescription(t *testing.T) {
 	md, err := cm.GetMetricsDescription(ctx)
 	assert.NoError(t, err)
 	assert.NotNil(t, md)
-	assert.Len(t, *md, 2)
+	assert.Len(t, *md, 6)
 }
 
 func TestGetMetrics(t *testing.T) {
@@ -39,3 +43,27 @@ func TestGetMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestGetMetricsWithVRAM(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-vram", generateGPUMapWithVRAM("nvidia-a10", 2, 0, 8*units.GiB))
+	_, err := cm.SetNodeResourceUsage(ctx, node, nil, nil, []plugintypes.WorkloadResource{
+		{
+			"prod_vram_map": types.VRAMMap{"nvidia-a10": 4 * units.GiB},
+			"vram_map":      types.VRAMMap{"0000:00:00.0": 4 * units.GiB},
+		},
+	}, true, true)
+	assert.NoError(t, err)
+
+	resp, err := cm.GetMetrics(ctx, "testpod", node)
+	assert.NoError(t, err)
+	values := map[string]string{}
+	for _, mt := range *resp {
+		values[mt.Name] = mt.Value
+	}
+	assert.Equal(t, "2", values["gpu_capacity"])
+	assert.Equal(t, "0.5", values["gpu_used"])
+	assert.Equal(t, fmt.Sprintf("%d", 16*units.GiB), values["gpu_vram_capacity"])
+	assert.Equal(t, fmt.Sprintf("%d", 4*units.GiB), values["gpu_vram_used"])
+}
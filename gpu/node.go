@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/cockroachdb/errors"
 	enginetypes "github.com/projecteru2/core/engine/types"
@@ -14,6 +15,7 @@ import (
 	coretypes "github.com/projecteru2/core/types"
 	"github.com/projecteru2/core/utils"
 	"github.com/sanity-io/litter"
+	"github.com/yuyang0/resource-gpu/gpu/store"
 	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
 )
 
@@ -47,7 +49,7 @@ func (p Plugin) AddNode(
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
-	capacity := gputypes.NewNodeResource(req.ProdCountMap)
+	capacity := gputypes.NewNodeResource(req.ProdCountMap, req.GPUMap, req.NUMA, req.MIGMap, req.ProdVRAM)
 	// try to fetch resource from info
 	if info != nil && info.Resources != nil { //nolint
 		if capacity.Count() == 0 {
@@ -56,17 +58,24 @@ func (p Plugin) AddNode(
 				if err != nil {
 					return nil, err
 				}
+				capacity = gputypes.NewNodeResource(capacity.ProdCountMap, capacity.GPUMap, capacity.NUMA, capacity.MIGMap, capacity.ProdVRAM)
 			}
 		}
 	}
+	if err := p.checkProds(capacity); err != nil {
+		return nil, err
+	}
 	nodeResourceInfo := &gputypes.NodeResourceInfo{
 		Capacity: capacity,
-		Usage:    gputypes.NewNodeResource(nil),
+		Usage:    gputypes.NewNodeResource(nil, nil, nil, nil, nil),
 	}
 
 	if err = p.doSetNodeResourceInfo(ctx, nodename, nodeResourceInfo); err != nil {
 		return nil, err
 	}
+	if err = p.doSetNodeLabels(ctx, nodename, req.Labels); err != nil {
+		return nil, err
+	}
 	return &plugintypes.AddNodeResponse{
 		Capacity: nodeResourceInfo.Capacity.AsRawParams(),
 		Usage:    nodeResourceInfo.Usage.AsRawParams(),
@@ -76,8 +85,25 @@ func (p Plugin) AddNode(
 // RemoveNode .
 func (p Plugin) RemoveNode(ctx context.Context, nodename string) (*plugintypes.RemoveNodeResponse, error) {
 	var err error
-	if _, err = p.store.Delete(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename)); err != nil {
+	if err = p.store.Delete(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename)); err != nil {
 		log.WithFunc("resource.gpu.RemoveNode").WithField("node", nodename).Error(ctx, err, "faield to delete node")
+		return &plugintypes.RemoveNodeResponse{}, err
+	}
+	if err = p.store.Delete(ctx, fmt.Sprintf(nodeLabelsKey, nodename)); err != nil {
+		log.WithFunc("resource.gpu.RemoveNode").WithField("node", nodename).Error(ctx, err, "faield to delete labels")
+		return &plugintypes.RemoveNodeResponse{}, err
+	}
+	if err = p.doRemoveAllocations(ctx, nodename); err != nil {
+		log.WithFunc("resource.gpu.RemoveNode").WithField("node", nodename).Error(ctx, err, "faield to delete allocations")
+		return &plugintypes.RemoveNodeResponse{}, err
+	}
+	if err = p.doRemoveProvisionals(ctx, nodename); err != nil {
+		log.WithFunc("resource.gpu.RemoveNode").WithField("node", nodename).Error(ctx, err, "faield to delete reservations")
+		return &plugintypes.RemoveNodeResponse{}, err
+	}
+	if err = p.doRemoveHistory(ctx, nodename); err != nil {
+		log.WithFunc("resource.gpu.RemoveNode").WithField("node", nodename).Error(ctx, err, "faield to delete history")
+		return &plugintypes.RemoveNodeResponse{}, err
 	}
 	return &plugintypes.RemoveNodeResponse{}, err
 }
@@ -88,6 +114,27 @@ func (p Plugin) GetNodesDeployCapacity(
 	resource plugintypes.WorkloadResourceRequest,
 ) (
 	*plugintypes.GetNodesDeployCapacityResponse, error,
+) {
+	resp, err := p.GetNodesDeployCapacityWithDiagnostics(ctx, nodenames, resource, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkUnavailable(ctx, resp.Diagnostics); err != nil {
+		return nil, err
+	}
+	return resp.GetNodesDeployCapacityResponse, nil
+}
+
+// GetNodesDeployCapacityWithDiagnostics is GetNodesDeployCapacity with the problems of nodes,
+// the call fails if there is any problem in strict mode, which is set by strict or config.
+// In explain mode, how the products requested limit the capacity of each node is returned too,
+// including the nodes left out because they can't deploy any workload.
+func (p Plugin) GetNodesDeployCapacityWithDiagnostics(
+	ctx context.Context, nodenames []string,
+	resource plugintypes.WorkloadResourceRequest,
+	strict bool, explain bool,
+) (
+	*gputypes.NodesDeployCapacityResponse, error,
 ) {
 	logger := log.WithFunc("resource.gpu.GetNodesDeployCapacity")
 	req := &gputypes.WorkloadResourceRequest{}
@@ -102,14 +149,35 @@ func (p Plugin) GetNodesDeployCapacity(
 
 	nodesDeployCapacityMap := map[string]*plugintypes.NodeDeployCapacity{}
 	total := 0
+	var explanations map[string]*gputypes.NodeExplanation
+	if explain {
+		explanations = map[string]*gputypes.NodeExplanation{}
+	}
 
-	nodesResourceInfos, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	nodesResourceInfos, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
 	if err != nil {
 		return nil, err
 	}
+	// the nodes without GPU can deploy the workloads which don't need GPU
+	if req.Empty() {
+		diagnostics = withoutZeroCapacity(diagnostics)
+	}
+	if err := p.checkDiagnostics(ctx, diagnostics, strict); err != nil {
+		return nil, err
+	}
+	if err := p.doApplyNodesProvisionals(ctx, nodesResourceInfos); err != nil {
+		return nil, err
+	}
+	if err := p.doApplyReservations(ctx, nodesResourceInfos, req.ReservationID, req.Tenant); err != nil {
+		return nil, err
+	}
 
 	for nodename, nodeResourceInfo := range nodesResourceInfos {
-		nodeDeployCapacity := p.doGetNodeDeployCapacity(nodeResourceInfo, req)
+		nodeDeployCapacity, explanation := p.doGetNodeDeployCapacity(nodeResourceInfo, req)
+		if explain {
+			explanation.Nodename = nodename
+			explanations[nodename] = explanation
+		}
 		if nodeDeployCapacity.Capacity > 0 {
 			nodesDeployCapacityMap[nodename] = nodeDeployCapacity
 			if total == math.MaxInt || nodeDeployCapacity.Capacity == math.MaxInt {
@@ -119,9 +187,13 @@ func (p Plugin) GetNodesDeployCapacity(
 			}
 		}
 	}
-	return &plugintypes.GetNodesDeployCapacityResponse{
-		NodeDeployCapacityMap: nodesDeployCapacityMap,
-		Total:                 total,
+	return &gputypes.NodesDeployCapacityResponse{
+		GetNodesDeployCapacityResponse: &plugintypes.GetNodesDeployCapacityResponse{
+			NodeDeployCapacityMap: nodesDeployCapacityMap,
+			Total:                 total,
+		},
+		Diagnostics:  diagnostics,
+		Explanations: explanations,
 	}, nil
 }
 
@@ -135,27 +207,31 @@ func (p Plugin) SetNodeResourceCapacity(
 	*plugintypes.SetNodeResourceCapacityResponse, error,
 ) {
 	logger := log.WithFunc("resource.gpu.SetNodeResourceCapacity").WithField("node", "nodename")
-	req, nodeResource, _, err := p.parseNodeResourceInfos(resourceRequest, resource, nil)
-	if err != nil {
-		return nil, err
-	}
-	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
-	if err != nil {
+	if _, _, _, err := p.parseNodeResourceInfos(resourceRequest, resource, nil); err != nil {
 		return nil, err
 	}
 
-	origin := nodeResourceInfo.Capacity
-	before := origin.DeepCopy()
-
-	if !delta && req != nil {
-		req.LoadFromOrigin(origin, resourceRequest)
-	}
-	nodeResourceInfo.Capacity = p.calculateNodeResource(req, nodeResource, origin, nil, delta, incr)
+	var before *gputypes.NodeResource
+	nodeResourceInfo, err := p.updateNodeResourceInfo(ctx, nodename, func(nodeResourceInfo *gputypes.NodeResourceInfo) (bool, error) {
+		// LoadFromOrigin modifies the request, so parse it again on every retry
+		req, nodeResource, _, err := p.parseNodeResourceInfos(resourceRequest, resource, nil)
+		if err != nil {
+			return false, err
+		}
+		origin := nodeResourceInfo.Capacity
+		before = origin.DeepCopy()
 
-	if err := p.doSetNodeResourceInfo(ctx, nodename, nodeResourceInfo); err != nil {
-		logger.Errorf(ctx, err, "node resource info %+v", litter.Sdump(nodeResourceInfo))
+		if !delta && req != nil {
+			req.LoadFromOrigin(origin, resourceRequest)
+		}
+		nodeResourceInfo.Capacity = p.calculateNodeResource(req, nodeResource, origin, nil, delta, incr)
+		return true, p.checkProds(nodeResourceInfo.Capacity)
+	})
+	if err != nil {
+		logger.Error(ctx, err)
 		return nil, err
 	}
+	p.appendHistory(ctx, nodename, gputypes.OpSetCapacity, delta, incr, before, nodeResourceInfo.Capacity)
 
 	return &plugintypes.SetNodeResourceCapacityResponse{
 		Before: before.AsRawParams(),
@@ -222,20 +298,59 @@ func (p Plugin) SetNodeResourceUsage(
 	if err != nil {
 		return nil, err
 	}
-	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
+
+	// the usage overwritten by the resource instead of workloads can't be split into records,
+	// so it's only allowed to clear the usage with the records, or on the node without records
+	var allocations map[string]*gputypes.WorkloadResource
+	byWorkloads := req == nil && nodeResource == nil
+	if !delta && !byWorkloads {
+		if allocations, err = p.doGetAllocations(ctx, nodename); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+	}
+	var before *gputypes.NodeResource
+	nodeResourceInfo, err := p.updateNodeResourceInfo(ctx, nodename, func(nodeResourceInfo *gputypes.NodeResourceInfo) (bool, error) {
+		origin := nodeResourceInfo.Usage
+		before = origin.DeepCopy()
+		nodeResourceInfo.Usage = p.calculateNodeResource(req, nodeResource, origin, wrksResource, delta, incr)
+		if len(allocations) > 0 && !nodeResourceInfo.Usage.Empty() {
+			return false, errors.Wrapf(gputypes.ErrAllocationsExist, "node %s has %d allocations, set the usage by workloads instead", nodename, len(allocations))
+		}
+		return true, nil
+	})
 	if err != nil {
+		logger.Error(ctx, err)
 		return nil, err
 	}
-
-	origin := nodeResourceInfo.Usage
-	before := origin.DeepCopy()
-
-	nodeResourceInfo.Usage = p.calculateNodeResource(req, nodeResource, origin, wrksResource, delta, incr)
-
-	if err := p.doSetNodeResourceInfo(ctx, nodename, nodeResourceInfo); err != nil {
-		logger.Errorf(ctx, err, "node resource info %+v", litter.Sdump(nodeResourceInfo))
-		return nil, err
+	// the usage is already set, so the records are left to FixNodeResource if they fail to update
+	if delta {
+		if err := p.doUpdateAllocations(ctx, nodename, wrksResource, incr); err != nil {
+			logger.Error(ctx, err, "failed to update allocations")
+		}
+		if err := p.doUpdateTenantsUsage(ctx, wrksResource, incr); err != nil {
+			logger.Error(ctx, err, "failed to update usage of tenants")
+		}
+		// the reservations are confirmed by the usage, or released by the rollback,
+		// they expire anyway if they fail to be dropped here
+		if p.provisionalEnabled() {
+			if err := p.doConfirmProvisionals(ctx, nodename, wrksResource); err != nil {
+				logger.Error(ctx, err, "failed to confirm reservations")
+			}
+		}
+	} else {
+		// the workloads passed are all the workloads on node
+		if byWorkloads {
+			if err := p.fixAllocations(ctx, nodename, workloadsResource); err != nil {
+				logger.Error(ctx, err, "failed to fix allocations")
+			}
+		} else if len(allocations) > 0 {
+			if err := p.doRemoveAllocations(ctx, nodename); err != nil {
+				logger.Error(ctx, err, "failed to remove allocations")
+			}
+		}
 	}
+	p.appendHistory(ctx, nodename, gputypes.OpSetUsage, delta, incr, before, nodeResourceInfo.Usage)
 
 	return &plugintypes.SetNodeResourceUsageResponse{
 		Before: before.AsRawParams(),
@@ -245,44 +360,91 @@ func (p Plugin) SetNodeResourceUsage(
 
 // GetMostIdleNode .
 func (p Plugin) GetMostIdleNode(ctx context.Context, nodenames []string) (*plugintypes.GetMostIdleNodeResponse, error) {
+	resp, err := p.GetMostIdleNodeWithDiagnostics(ctx, nodenames, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkUnavailable(ctx, resp.Diagnostics); err != nil {
+		return nil, err
+	}
+	return resp.GetMostIdleNodeResponse, nil
+}
+
+// GetMostIdleNodeWithDiagnostics is GetMostIdleNode with the problems of nodes,
+// the call fails if there is any problem in strict mode, which is set by strict or config.
+func (p Plugin) GetMostIdleNodeWithDiagnostics(ctx context.Context, nodenames []string, strict bool) (*gputypes.MostIdleNodeResponse, error) {
 	var mostIdleNode string
-	var minIdle = math.MaxFloat64
+	var minScore = math.Inf(1)
 
-	nodesResourceInfo, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	nodesResourceInfo, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
 	if err != nil {
 		return nil, err
 	}
+	if err := p.checkDiagnostics(ctx, diagnostics, strict); err != nil {
+		return nil, err
+	}
 
+	weights := p.scarcityWeights(nodesResourceInfo)
 	for nodename, nodeResourceInfo := range nodesResourceInfo {
-		var idle float64
-		if nodeResourceInfo.CapCount() > 0 {
-			idle = float64(nodeResourceInfo.UsageCount()) / float64(nodeResourceInfo.CapCount())
-		}
-
-		if idle < minIdle {
+		score := p.idleScore(nodeResourceInfo, weights)
+		if mostIdleNode == "" || score < minScore || (score == minScore && nodename < mostIdleNode) {
 			mostIdleNode = nodename
-			minIdle = idle
+			minScore = score
 		}
 	}
-	return &plugintypes.GetMostIdleNodeResponse{
-		Nodename: mostIdleNode,
-		Priority: priority,
+	// none of the nodes is usable, skipping them leaves nothing to choose
+	if mostIdleNode == "" && len(diagnostics) > 0 {
+		return nil, gputypes.DiagnosticsError(diagnostics)
+	}
+	priority := 0
+	if nodeResourceInfo, ok := nodesResourceInfo[mostIdleNode]; ok {
+		priority = p.idlePriority(nodeResourceInfo, weights)
+	}
+	return &gputypes.MostIdleNodeResponse{
+		GetMostIdleNodeResponse: &plugintypes.GetMostIdleNodeResponse{
+			Nodename: mostIdleNode,
+			Priority: priority,
+		},
+		Diagnostics: diagnostics,
 	}, nil
 }
 
 // FixNodeResource .
 // use workloadsReource to construct a new NodeResource, then use this NodeResource to repace Usage
 func (p Plugin) FixNodeResource(ctx context.Context, nodename string, workloadsResource []plugintypes.WorkloadResource) (*plugintypes.GetNodeResourceInfoResponse, error) {
-	nodeResourceInfo, actuallyWorkloadsUsage, diffs, err := p.getNodeResourceInfo(ctx, nodename, workloadsResource)
+	nodeResourceInfo, _, diffs, err := p.getNodeResourceInfo(ctx, nodename, workloadsResource)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(diffs) != 0 {
-		nodeResourceInfo.Usage = &gputypes.NodeResource{
-			ProdCountMap: actuallyWorkloadsUsage.ProdCountMap,
+		var before *gputypes.NodeResource
+		fixed, err := p.updateNodeResourceInfo(ctx, nodename, func(nodeResourceInfo *gputypes.NodeResourceInfo) (bool, error) {
+			// the usage may be changed since the diffs are calculated, so do it again
+			actuallyWorkloadsUsage, diffs, err := p.diffNodeResourceInfo(nodeResourceInfo, workloadsResource)
+			if err != nil || len(diffs) == 0 {
+				before = nil
+				return false, err
+			}
+			before = nodeResourceInfo.Usage.DeepCopy()
+			nodeResourceInfo.Usage = &gputypes.NodeResource{
+				ProdCountMap: actuallyWorkloadsUsage.ProdCountMap,
+				AddrCountMap: actuallyWorkloadsUsage.AddrCountMap,
+				VRAMMap:      actuallyWorkloadsUsage.VRAMMap,
+				MIGCountMap:  actuallyWorkloadsUsage.MIGCountMap,
+			}
+			return true, nil
+		})
+		if err != nil {
+			log.WithFunc("resource.gpu.FixNodeResource").Error(ctx, err)
+			diffs = append(diffs, err.Error())
+		} else {
+			nodeResourceInfo = fixed
+			if before != nil {
+				p.appendHistory(ctx, nodename, gputypes.OpFix, false, false, before, nodeResourceInfo.Usage)
+			}
 		}
-		if err = p.doSetNodeResourceInfo(ctx, nodename, nodeResourceInfo); err != nil {
+		if err := p.fixAllocations(ctx, nodename, workloadsResource); err != nil {
 			log.WithFunc("resource.gpu.FixNodeResource").Error(ctx, err)
 			diffs = append(diffs, err.Error())
 		}
@@ -302,12 +464,26 @@ func (p Plugin) getNodeResourceInfo(ctx context.Context, nodename string, worklo
 		return nodeResourceInfo, nil, nil, err
 	}
 
-	actuallyWorkloadsUsage := &gputypes.WorkloadResource{ProdCountMap: gputypes.ProdCountMap{}}
+	actuallyWorkloadsUsage, diffs, err := p.diffNodeResourceInfo(nodeResourceInfo, workloadsResource)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, nil, nil, err
+	}
+	_, _, allocationDiffs, err := p.diffAllocations(ctx, nodename, workloadsResource)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, nil, nil, err
+	}
+	return nodeResourceInfo, actuallyWorkloadsUsage, append(diffs, allocationDiffs...), nil
+}
+
+// diffNodeResourceInfo compares the usage of node with the sum of workloads resource
+func (p Plugin) diffNodeResourceInfo(nodeResourceInfo *gputypes.NodeResourceInfo, workloadsResource []plugintypes.WorkloadResource) (*gputypes.WorkloadResource, []string, error) {
+	actuallyWorkloadsUsage := (&gputypes.WorkloadResource{}).DeepCopy() // init nil maps
 	for _, workloadResource := range workloadsResource {
 		workloadUsage := &gputypes.WorkloadResource{}
 		if err := workloadUsage.Parse(workloadResource); err != nil {
-			logger.Error(ctx, err)
-			return nil, nil, nil, err
+			return nil, nil, err
 		}
 		actuallyWorkloadsUsage.Add(workloadUsage)
 	}
@@ -327,51 +503,171 @@ func (p Plugin) getNodeResourceInfo(ctx context.Context, nodename string, worklo
 			diffs = append(diffs, fmt.Sprintf("%s: actual(%d) != usage(%d)", prod, count1, count2))
 		}
 	}
+	for addr, count := range actuallyWorkloadsUsage.AddrCountMap {
+		if _, ok := nodeResourceInfo.Capacity.GPUMap[addr]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s not in capacity", addr))
+		}
+		if count > 1 {
+			diffs = append(diffs, fmt.Sprintf("%s is held by %d workloads", addr, count))
+		}
+		if _, ok := nodeResourceInfo.Usage.AddrCountMap[addr]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s not in usage", addr))
+		}
+	}
+	for addr := range nodeResourceInfo.Usage.AddrCountMap {
+		if _, ok := actuallyWorkloadsUsage.AddrCountMap[addr]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is not held by any workload", addr))
+		}
+	}
+	for addr, vram := range actuallyWorkloadsUsage.VRAMMap {
+		info, ok := nodeResourceInfo.Capacity.GPUMap[addr]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s not in capacity", addr))
+		} else if vram > info.VRAM {
+			diffs = append(diffs, fmt.Sprintf("%s: shared vram(%d) > vram(%d)", addr, vram, info.VRAM))
+		}
+		if _, ok := actuallyWorkloadsUsage.AddrCountMap[addr]; ok {
+			diffs = append(diffs, fmt.Sprintf("%s is both held and shared", addr))
+		}
+		if usage := nodeResourceInfo.Usage.VRAMMap[addr]; usage != vram {
+			diffs = append(diffs, fmt.Sprintf("%s: actual vram(%d) != usage vram(%d)", addr, vram, usage))
+		}
+	}
+	for addr, vram := range nodeResourceInfo.Usage.VRAMMap {
+		if _, ok := actuallyWorkloadsUsage.VRAMMap[addr]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: actual vram(0) != usage vram(%d)", addr, vram))
+		}
+	}
+	for uuid, count := range actuallyWorkloadsUsage.MIGCountMap {
+		if _, ok := nodeResourceInfo.Capacity.MIGMap[uuid]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s not in capacity", uuid))
+		}
+		if count > 1 {
+			diffs = append(diffs, fmt.Sprintf("%s is held by %d workloads", uuid, count))
+		}
+		if _, ok := nodeResourceInfo.Usage.MIGCountMap[uuid]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s not in usage", uuid))
+		}
+	}
+	for uuid := range nodeResourceInfo.Usage.MIGCountMap {
+		if _, ok := actuallyWorkloadsUsage.MIGCountMap[uuid]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is not held by any workload", uuid))
+		}
+	}
 
-	return nodeResourceInfo, actuallyWorkloadsUsage, diffs, nil
+	return actuallyWorkloadsUsage, diffs, nil
 }
 
 func (p Plugin) doGetNodeResourceInfo(ctx context.Context, nodename string) (*gputypes.NodeResourceInfo, error) {
-	key := fmt.Sprintf(nodeResourceInfoKey, nodename)
-	resp, err := p.store.Get(ctx, key)
-	if err != nil {
-		return nil, err
-	}
-
-	r := &gputypes.NodeResourceInfo{}
-	switch resp.Count {
-	case 0:
-		return r, errors.Wrapf(coretypes.ErrNodeNotExists, "key: %s", nodename)
-	case 1:
-		if err := json.Unmarshal(resp.Kvs[0].Value, r); err != nil {
-			return nil, err
-		}
-		return r, nil
-	default:
-		return nil, errors.Wrapf(coretypes.ErrInvaildCount, "key: %s", nodename)
-	}
+	r, _, err := p.doGetNodeResourceInfoWithRevision(ctx, nodename)
+	return r, err
 }
 
-func (p Plugin) doGetNodesResourceInfo(ctx context.Context, nodenames []string) (map[string]*gputypes.NodeResourceInfo, error) {
+// doGetNodesResourceInfo returns the resource info of the nodes found,
+// the nodes not found or corrupt are skipped and reported in diagnostics, so are the nodes without GPU but they are kept.
+func (p Plugin) doGetNodesResourceInfo(ctx context.Context, nodenames []string) (map[string]*gputypes.NodeResourceInfo, []*gputypes.NodeDiagnostic, error) {
 	keys := []string{}
 	for _, nodename := range nodenames {
 		keys = append(keys, fmt.Sprintf(nodeResourceInfoKey, nodename))
 	}
 	resps, err := p.store.GetMulti(ctx, keys)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	result := map[string]*gputypes.NodeResourceInfo{}
+	diagnostics := []*gputypes.NodeDiagnostic{}
+	found := map[string]bool{}
 
 	for _, resp := range resps {
-		r := &gputypes.NodeResourceInfo{}
-		if err := json.Unmarshal(resp.Value, r); err != nil {
-			return nil, err
+		nodename := utils.Tail(resp.Key)
+		found[nodename] = true
+		r, err := p.unmarshalNodeResourceInfo(resp.Value)
+		if err == nil {
+			err = r.Validate()
+		}
+		if err != nil {
+			diagnostics = append(diagnostics, &gputypes.NodeDiagnostic{Nodename: nodename, Problem: gputypes.DiagnosticCorrupt, Message: err.Error()})
+			continue
+		}
+		if r.CapCount() == 0 && len(r.Capacity.MIGMap) == 0 {
+			diagnostics = append(diagnostics, &gputypes.NodeDiagnostic{Nodename: nodename, Problem: gputypes.DiagnosticZeroCapacity})
+		}
+		result[nodename] = r
+	}
+	for _, nodename := range nodenames {
+		if !found[nodename] {
+			diagnostics = append(diagnostics, &gputypes.NodeDiagnostic{Nodename: nodename, Problem: gputypes.DiagnosticNotFound})
+			// report once for the duplicated nodenames
+			found[nodename] = true
 		}
-		result[utils.Tail(string(resp.Key))] = r
 	}
-	return result, nil
+	sort.Slice(diagnostics, func(i, j int) bool { return diagnostics[i].Nodename < diagnostics[j].Nodename })
+	return result, diagnostics, nil
+}
+
+// doListNodenames returns the names of all the nodes
+func (p Plugin) doListNodenames(ctx context.Context) ([]string, error) {
+	kvs, err := p.store.GetPrefix(ctx, nodeResourceInfoPrefix)
+	if err != nil {
+		return nil, err
+	}
+	nodenames := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		nodenames = append(nodenames, utils.Tail(kv.Key))
+	}
+	return nodenames, nil
+}
+
+// checkDiagnostics returns the error of diagnostics in strict mode, otherwise they are only logged
+func (p Plugin) checkDiagnostics(ctx context.Context, diagnostics []*gputypes.NodeDiagnostic, strict bool) error {
+	err := gputypes.DiagnosticsError(diagnostics)
+	if err == nil || strict || p.gpuConfig.Scheduler.Strict {
+		return err
+	}
+	log.WithFunc("resource.gpu.checkDiagnostics").Warn(ctx, err.Error())
+	return nil
+}
+
+// checkUnavailable returns the error of the nodes not found or corrupt unless they are allowed to be skipped by config,
+// it's for the calls of eru-core, which can't get the diagnostics. The nodes not found fail the call with ErrInvaildCount as before.
+func (p Plugin) checkUnavailable(ctx context.Context, diagnostics []*gputypes.NodeDiagnostic) error {
+	unavailable := withoutZeroCapacity(diagnostics)
+	err := gputypes.DiagnosticsError(unavailable)
+	if err == nil {
+		return nil
+	}
+	if p.gpuConfig.Scheduler.SkipUnavailable {
+		log.WithFunc("resource.gpu.checkUnavailable").Warn(ctx, err.Error())
+		return nil
+	}
+	for _, diagnostic := range unavailable {
+		if diagnostic.Problem == gputypes.DiagnosticNotFound {
+			return errors.Wrap(coretypes.ErrInvaildCount, err.Error())
+		}
+	}
+	return err
+}
+
+// withoutZeroCapacity drops the diagnostics of the nodes without GPU
+func withoutZeroCapacity(diagnostics []*gputypes.NodeDiagnostic) []*gputypes.NodeDiagnostic {
+	res := []*gputypes.NodeDiagnostic{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Problem != gputypes.DiagnosticZeroCapacity {
+			res = append(res, diagnostic)
+		}
+	}
+	return res
+}
+
+func (p Plugin) unmarshalNodeResourceInfo(data []byte) (*gputypes.NodeResourceInfo, error) {
+	r := &gputypes.NodeResourceInfo{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	// the data written by older versions doesn't have all the fields,
+	// so deep copy it here to make sure there is no nil map
+	return r.DeepCopy(), nil
 }
 
 func (p Plugin) doSetNodeResourceInfo(ctx context.Context, nodename string, resourceInfo *gputypes.NodeResourceInfo) error {
@@ -384,42 +680,346 @@ func (p Plugin) doSetNodeResourceInfo(ctx context.Context, nodename string, reso
 		return err
 	}
 
-	_, err = p.store.Put(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename), string(data))
-	return err
+	return p.store.Put(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename), string(data))
+}
+
+// doGetNodeResourceInfoWithRevision returns the resource info of node and the mod revision of its key
+func (p Plugin) doGetNodeResourceInfoWithRevision(ctx context.Context, nodename string) (*gputypes.NodeResourceInfo, int64, error) {
+	kv, err := p.store.Get(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename))
+	if errors.Is(err, store.ErrKeyNotExists) {
+		return &gputypes.NodeResourceInfo{}, 0, errors.Wrapf(coretypes.ErrNodeNotExists, "key: %s", nodename)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := p.unmarshalNodeResourceInfo(kv.Value)
+	return r, kv.Revision, err
+}
+
+// doCompareAndSetNodeResourceInfo writes the resource info of node only if its key is still at revision,
+// returns false if the key was modified by others
+func (p Plugin) doCompareAndSetNodeResourceInfo(ctx context.Context, nodename string, resourceInfo *gputypes.NodeResourceInfo, revision int64) (bool, error) {
+	if err := resourceInfo.Validate(); err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(resourceInfo)
+	if err != nil {
+		return false, err
+	}
+
+	return p.store.CompareAndSwap(ctx, fmt.Sprintf(nodeResourceInfoKey, nodename), string(data), revision)
 }
 
-func (p Plugin) doGetNodeDeployCapacity(nodeResourceInfo *gputypes.NodeResourceInfo, req *gputypes.WorkloadResourceRequest) *plugintypes.NodeDeployCapacity {
+// updateNodeResourceInfo applies update to the resource info of node with compare-and-swap,
+// update is called again with the latest resource info if the node is modified concurrently,
+// nothing is written if update returns false.
+func (p Plugin) updateNodeResourceInfo(ctx context.Context, nodename string, update func(*gputypes.NodeResourceInfo) (bool, error)) (*gputypes.NodeResourceInfo, error) {
+	for i := 0; i < maxCASRetries; i++ {
+		nodeResourceInfo, revision, err := p.doGetNodeResourceInfoWithRevision(ctx, nodename)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := update(nodeResourceInfo)
+		if err != nil || !changed {
+			return nodeResourceInfo, err
+		}
+		ok, err := p.doCompareAndSetNodeResourceInfo(ctx, nodename, nodeResourceInfo, revision)
+		if err != nil {
+			log.WithFunc("resource.gpu.updateNodeResourceInfo").Errorf(ctx, err, "node resource info %+v", litter.Sdump(nodeResourceInfo))
+			return nil, err
+		}
+		if ok {
+			return nodeResourceInfo, nil
+		}
+	}
+	return nil, errors.Wrapf(gputypes.ErrConflict, "node: %s, retried %d times", nodename, maxCASRetries)
+}
+
+// doGetNodeDeployCapacity returns the capacity of the alternative which can deploy the most workloads,
+// the earlier one is preferred if they can deploy the same number of workloads.
+func (p Plugin) doGetNodeDeployCapacity(nodeResourceInfo *gputypes.NodeResourceInfo, req *gputypes.WorkloadResourceRequest) (*plugintypes.NodeDeployCapacity, *gputypes.NodeExplanation) {
+	var capacityInfo *plugintypes.NodeDeployCapacity
+	var explanation *gputypes.NodeExplanation
+	for _, altReq := range req.Expand() {
+		if altCapacityInfo, altExplanation := p.calculateNodeDeployCapacity(nodeResourceInfo, altReq); capacityInfo == nil || altCapacityInfo.Capacity > capacityInfo.Capacity {
+			capacityInfo, explanation = altCapacityInfo, altExplanation
+			if len(req.Alternatives) > 0 {
+				explanation.Alternative = altReq.ProdCountMap.DeepCopy()
+			}
+		}
+	}
+	explanation.Capacity = capacityInfo.Capacity
+	return capacityInfo, explanation
+}
+
+// calculateNodeDeployCapacity returns the capacity of node and how each product of the request limits it
+func (p Plugin) calculateNodeDeployCapacity(nodeResourceInfo *gputypes.NodeResourceInfo, req *gputypes.WorkloadResourceRequest) (*plugintypes.NodeDeployCapacity, *gputypes.NodeExplanation) {
 	availableResource := nodeResourceInfo.GetAvailableResource()
 
 	capacityInfo := &plugintypes.NodeDeployCapacity{
-		Weight:   1, // TODO why 1?
+		Weight:   p.gpuConfig.Weight(),
 		Capacity: maxCapacity,
 	}
-	if req.Count() == 0 { //nolint
-		// if count equals to 0, then assign a big value to capacity
-		capacityInfo.Capacity = maxCapacity
-	} else {
-		for reqProd, reqCount := range req.ProdCountMap {
-			// don't need to check if reqProd exist in availableResource here,
-			// because if reqProd doesn't exist in availableResource, then count is 0
-			// and prodCap and capacityInfo.Capacity will be 0 too, so it will also break the loop
-			count := availableResource.ProdCountMap[reqProd]
-			prodCap := count / reqCount
-			if prodCap < capacityInfo.Capacity {
-				capacityInfo.Capacity = prodCap
+	explanation := &gputypes.NodeExplanation{Products: []*gputypes.ProdExplanation{}}
+	explain := func(prodExplanation *gputypes.ProdExplanation) {
+		// capacity may be negative integer, set it to zero here
+		prodExplanation.Capacity = utils.Max(prodExplanation.Capacity, 0)
+		explanation.Products = append(explanation.Products, prodExplanation)
+		if prodExplanation.Capacity < capacityInfo.Capacity {
+			capacityInfo.Capacity = prodExplanation.Capacity
+			explanation.Limit = prodExplanation.Product
+		}
+	}
+	// if the request doesn't need GPU, the capacity is a big value
+	if !req.Empty() {
+		fixed, parts := p.splitRequest(nodeResourceInfo, req)
+		for _, reqProd := range fixed.Keys() {
+			// if reqProd doesn't exist in availableResource, then count is 0 and so is the capacity
+			reqCount := fixed[reqProd]
+			free := p.freeCount(nodeResourceInfo, availableResource, reqProd)
+			explain(&gputypes.ProdExplanation{Product: reqProd, Kind: gputypes.ExplainCount, Requested: int64(reqCount), Available: int64(free), Capacity: free / reqCount})
+		}
+		for _, reqProd := range req.ProdVRAMMap.Keys() {
+			// every workload needs a slice on one of the shared devices
+			reqVRAM := req.ProdVRAMMap[reqProd]
+			slices, free := 0, int64(0)
+			for addr, addrFree := range availableResource.VRAMMap {
+				if nodeResourceInfo.Capacity.GPUMap[addr].Product == reqProd {
+					slices += int(addrFree / reqVRAM)
+					free += addrFree
+				}
+			}
+			explain(&gputypes.ProdExplanation{Product: reqProd, Kind: gputypes.ExplainVRAM, Requested: reqVRAM, Available: free, Capacity: slices})
+		}
+		profileCountMap := availableResource.MIGMap.ProfileCountMap()
+		for _, reqProfile := range req.ProfileCountMap.Keys() {
+			reqCount := req.ProfileCountMap[reqProfile]
+			free := profileCountMap[reqProfile]
+			explain(&gputypes.ProdExplanation{Product: reqProfile, Kind: gputypes.ExplainMIG, Requested: int64(reqCount), Available: int64(free), Capacity: free / reqCount})
+		}
+		if len(parts) > 0 {
+			flexibleCapacity := p.flexibleCapacity(nodeResourceInfo, availableResource, fixed, parts, capacityInfo.Capacity)
+			var scarcest *gputypes.ProdExplanation
+			for _, part := range parts {
+				free := 0
+				for _, prod := range part.prods {
+					free += p.freeCount(nodeResourceInfo, availableResource, prod)
+				}
+				prodExplanation := &gputypes.ProdExplanation{Product: part.name, Kind: gputypes.ExplainFlexible, Requested: int64(part.count), Available: int64(free), Capacity: free / part.count}
+				explain(prodExplanation)
+				if scarcest == nil || prodExplanation.Capacity < scarcest.Capacity {
+					scarcest = prodExplanation
+				}
+			}
+			if flexibleCapacity < capacityInfo.Capacity {
+				// the flexible parts share products with each other and the fixed part,
+				// the scarcest of them is blamed
+				capacityInfo.Capacity = flexibleCapacity
+				explanation.Limit = scarcest.Product
+			}
+		}
+	}
+	if capGPUs := nodeResourceInfo.CapGPUs(); capGPUs > 0 {
+		reqGPUs := float64(req.Count() + req.MinVRAMCount)
+		for reqProd, reqVRAM := range req.ProdVRAMMap {
+			if vram := nodeResourceInfo.Capacity.GPUMap.VRAMOf(reqProd); vram > 0 {
+				reqGPUs += float64(reqVRAM) / float64(vram)
+			}
+		}
+		for reqProfile, reqCount := range req.ProfileCountMap {
+			reqGPUs += float64(reqCount) * gputypes.MIGInfo{Profile: reqProfile}.Fraction()
+		}
+		// eru-core prefers the node with the lowest usage, and adds rate to usage after each deployment
+		switch p.gpuConfig.Strategy() {
+		case gputypes.StrategyBinpack:
+			capacityInfo.Usage = 1 - nodeResourceInfo.UsageGPUs()/capGPUs
+			capacityInfo.Rate = -reqGPUs / capGPUs
+		case gputypes.StrategyBestfit:
+			capacityInfo.Usage = p.leftoverGPUs(nodeResourceInfo, availableResource, req) / capGPUs
+			capacityInfo.Rate = -reqGPUs / capGPUs
+		default:
+			capacityInfo.Usage = nodeResourceInfo.UsageGPUs() / capGPUs
+			capacityInfo.Rate = reqGPUs / capGPUs
+		}
+	}
+	return capacityInfo, explanation
+}
+
+// leftoverGPUs returns the free GPUs of the requested products, all the free GPUs if the request doesn't need GPU,
+// the shared GPUs are counted by the proportion of free VRAM, and the MIG instances by the proportion of compute slices.
+func (p Plugin) leftoverGPUs(nodeResourceInfo *gputypes.NodeResourceInfo, availableResource *gputypes.NodeResource, req *gputypes.WorkloadResourceRequest) float64 {
+	if req.Empty() {
+		return nodeResourceInfo.CapGPUs() - nodeResourceInfo.UsageGPUs()
+	}
+	fixed, parts := p.splitRequest(nodeResourceInfo, req)
+	prods := map[string]struct{}{}
+	for prod := range fixed {
+		prods[prod] = struct{}{}
+	}
+	for _, part := range parts {
+		for _, prod := range part.prods {
+			prods[prod] = struct{}{}
+		}
+	}
+	leftover := 0.0
+	for prod := range prods {
+		leftover += float64(p.freeCount(nodeResourceInfo, availableResource, prod))
+	}
+	for addr, free := range availableResource.VRAMMap {
+		info := nodeResourceInfo.Capacity.GPUMap[addr]
+		if _, ok := req.ProdVRAMMap[info.Product]; ok {
+			leftover += float64(free) / float64(info.VRAM)
+		}
+	}
+	for _, info := range availableResource.MIGMap {
+		if _, ok := req.ProfileCountMap[info.Profile]; ok {
+			leftover += info.Fraction()
+		}
+	}
+	return leftover
+}
+
+// idleScore returns the score of node by strategy, the node with the lowest score is preferred,
+// the nodes without GPU are the last choices, so are the nodes without free GPUs for binpack and bestfit.
+// The GPUs are weighted by the scarcity of products, so an idle scarce GPU keeps the node idle.
+func (p Plugin) idleScore(nodeResourceInfo *gputypes.NodeResourceInfo, weights map[string]float64) float64 {
+	strategy := p.gpuConfig.Strategy()
+	if strategy != gputypes.StrategySpread && nodeResourceInfo.UsageGPUs() >= nodeResourceInfo.CapGPUs() {
+		return math.Inf(1)
+	}
+	capGPUs, usage := p.weightedGPUs(nodeResourceInfo, weights)
+	switch strategy {
+	case gputypes.StrategyBinpack:
+		return -usage / capGPUs
+	case gputypes.StrategyBestfit:
+		return capGPUs - usage
+	default:
+		if capGPUs <= 0 {
+			return math.Inf(1)
+		}
+		return usage / capGPUs
+	}
+}
+
+// idlePriority returns the priority of GetMostIdleNode by the weighted idleness of the node chosen,
+// eru-core trusts the plugin more if the node is more idle, the node without GPU has no priority.
+func (p Plugin) idlePriority(nodeResourceInfo *gputypes.NodeResourceInfo, weights map[string]float64) int {
+	capGPUs, usage := p.weightedGPUs(nodeResourceInfo, weights)
+	if capGPUs <= 0 {
+		return 0
+	}
+	idleness := math.Max(0, math.Min(1, 1-usage/capGPUs))
+	return int(math.Round(maxPriority * idleness))
+}
+
+// weightedGPUs returns the capacity and usage of node in GPUs weighted by products, the unknown products weigh 1
+func (p Plugin) weightedGPUs(nodeResourceInfo *gputypes.NodeResourceInfo, weights map[string]float64) (float64, float64) {
+	usage := nodeResourceInfo.ProdUsageGPUs()
+	var weightedCap, weightedUsage float64
+	for prod, count := range nodeResourceInfo.ProdCapGPUs() {
+		weight, ok := weights[prod]
+		if !ok {
+			weight = 1
+		}
+		weightedCap += weight * count
+		weightedUsage += weight * usage[prod]
+	}
+	return weightedCap, weightedUsage
+}
+
+// scarcityWeights returns the weight of each product on the nodes, the weight in catalog takes precedence,
+// otherwise it's the total GPUs of the nodes divided by the GPUs of the product, so the scarce products weigh more.
+// Only the candidate nodes are counted, so the scarcity is the one among the nodes to choose from.
+func (p Plugin) scarcityWeights(nodesResourceInfo map[string]*gputypes.NodeResourceInfo) map[string]float64 {
+	weights := map[string]float64{}
+	for prod, info := range p.gpuConfig.Products {
+		if info.Weight > 0 {
+			weights[prod] = info.Weight
+		}
+	}
+	totals := map[string]float64{}
+	var total float64
+	for _, nodeResourceInfo := range nodesResourceInfo {
+		for prod, count := range nodeResourceInfo.ProdCapGPUs() {
+			totals[prod] += count
+			total += count
+		}
+	}
+	for prod, count := range totals {
+		if _, ok := weights[prod]; !ok && count > 0 {
+			weights[prod] = total / count
+		}
+	}
+	return weights
+}
+
+// checkProds rejects the products not in catalog
+func (p Plugin) checkProds(capacity *gputypes.NodeResource) error {
+	prods := []string{}
+	for prod := range capacity.ProdCountMap {
+		prods = append(prods, prod)
+	}
+	for _, info := range capacity.GPUMap {
+		prods = append(prods, info.Product)
+	}
+	for prod := range capacity.ProdVRAM {
+		prods = append(prods, prod)
+	}
+	for _, prod := range prods {
+		if !p.gpuConfig.IsKnownProd(prod) {
+			return errors.Wrapf(gputypes.ErrInvalidGPUProduct, "unknown product %s", prod)
+		}
+	}
+	return nil
+}
+
+// freeCount returns the number of GPUs of the product can be allocated,
+// if the node has a device inventory of this product, only the free devices can be allocated
+func (p Plugin) freeCount(nodeResourceInfo *gputypes.NodeResourceInfo, availableResource *gputypes.NodeResource, prod string) int {
+	count := availableResource.ProdCountMap[prod]
+	if nodeResourceInfo.Capacity.GPUMap.HasProd(prod) {
+		count = utils.Min(count, len(availableResource.GPUMap.ListByProd(prod)))
+	}
+	return count
+}
+
+// flexibleCapacity returns how many workloads can be deployed when each of them also needs
+// the flexible parts of the request, limit is the capacity calculated from the other parts of the request.
+func (p Plugin) flexibleCapacity(nodeResourceInfo *gputypes.NodeResourceInfo, availableResource *gputypes.NodeResource, fixed gputypes.ProdCountMap, parts []flexiblePart, limit int) int {
+	fit := func(n int) bool {
+		remain := gputypes.ProdCountMap{}
+		for prod := range nodeResourceInfo.Capacity.ProdCountMap {
+			remain[prod] = p.freeCount(nodeResourceInfo, availableResource, prod) - n*fixed[prod]
+		}
+		// the parts are satisfied greedily by the products in preference order, like doAlloc does
+		for _, part := range parts {
+			need := n
+			for _, prod := range part.prods {
+				if remain[prod] <= 0 {
+					continue
+				}
+				workloads := utils.Min(need, remain[prod]/part.count)
+				remain[prod] -= workloads * part.count
+				need -= workloads
 			}
-			if capacityInfo.Capacity <= 0 {
-				// Capacity may be negative integer, set it to zero here
-				capacityInfo.Capacity = 0
-				break
+			if need > 0 {
+				return false
 			}
 		}
+		return true
 	}
-	if nodeResourceInfo.CapCount() > 0 {
-		capacityInfo.Usage = float64(nodeResourceInfo.UsageCount()) / float64(nodeResourceInfo.CapCount())
-		capacityInfo.Rate = float64(req.Count()) / float64(nodeResourceInfo.CapCount())
+	// fit is monotonic, so binary search the largest n which fits
+	low, high := 0, limit
+	for low < high {
+		mid := low + (high-low+1)/2
+		if fit(mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
 	}
-	return capacityInfo
+	return low
 }
 
 // 丢弃origin，完全用新数据重写
@@ -428,6 +1028,10 @@ func (p Plugin) overwriteNodeResource(req *gputypes.NodeResourceRequest, nodeRes
 	if req != nil {
 		nodeResource = &gputypes.NodeResource{
 			ProdCountMap: req.ProdCountMap,
+			GPUMap:       req.GPUMap,
+			NUMA:         req.NUMA,
+			MIGMap:       req.MIGMap,
+			ProdVRAM:     req.ProdVRAM,
 		}
 	}
 
@@ -439,6 +1043,9 @@ func (p Plugin) overwriteNodeResource(req *gputypes.NodeResourceRequest, nodeRes
 	for _, workloadResource := range workloadsResource {
 		nodeResource = &gputypes.NodeResource{
 			ProdCountMap: workloadResource.ProdCountMap,
+			AddrCountMap: workloadResource.AddrCountMap,
+			VRAMMap:      workloadResource.VRAMMap,
+			MIGCountMap:  workloadResource.MIGCountMap,
 		}
 		resp.Add(nodeResource)
 	}
@@ -451,6 +1058,10 @@ func (p Plugin) incrUpdateNodeResource(req *gputypes.NodeResourceRequest, nodeRe
 	if req != nil {
 		nodeResource = &gputypes.NodeResource{
 			ProdCountMap: req.ProdCountMap,
+			GPUMap:       req.GPUMap,
+			NUMA:         req.NUMA,
+			MIGMap:       req.MIGMap,
+			ProdVRAM:     req.ProdVRAM,
 		}
 	}
 
@@ -466,6 +1077,9 @@ func (p Plugin) incrUpdateNodeResource(req *gputypes.NodeResourceRequest, nodeRe
 	for _, workloadResource := range workloadsResource {
 		nodeResource = &gputypes.NodeResource{
 			ProdCountMap: workloadResource.ProdCountMap,
+			AddrCountMap: workloadResource.AddrCountMap,
+			VRAMMap:      workloadResource.VRAMMap,
+			MIGCountMap:  workloadResource.MIGCountMap,
 		}
 		if incr {
 			resp.Add(nodeResource)
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/go-units"
 	enginetypes "github.com/projecteru2/core/engine/types"
@@ -96,6 +100,25 @@ func TestRemoveNode(t *testing.T) {
 	_, err = cm.RemoveNode(ctx, nodeForDel)
 	assert.Nil(t, err)
 
+	// the history and the reservations go with the node
+	cm = initGPUWithConfig(ctx, t, &types.Config{Provisional: types.ProvisionalConfig{TTL: time.Minute}})
+	node = generateNodeWithGPUMap(ctx, t, cm, "test-remove", generateGPUMap("nvidia-3070", 4, 0))
+	req := plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}}
+	d, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	_, err = cm.RemoveNode(ctx, node)
+	assert.Nil(t, err)
+	for _, prefix := range []string{historyPrefix, provisionalPrefix, allocationPrefix} {
+		kvs, err := cm.store.GetPrefix(ctx, fmt.Sprintf(prefix, node))
+		assert.Nil(t, err)
+		assert.Empty(t, kvs)
+	}
+	_, err = cm.store.Get(ctx, fmt.Sprintf(provisionalSeqKey, node))
+	assert.Error(t, err)
 }
 
 func TestGetNodesDeployCapacity(t *testing.T) {
@@ -124,6 +147,14 @@ func TestGetNodesDeployCapacity(t *testing.T) {
 	_, err = cm.GetNodesDeployCapacity(ctx, []string{"xxx"}, req)
 	assert.True(t, errors.Is(err, coretypes.ErrInvaildCount))
 
+	// non-existent node is reported, and fails the call in strict mode
+	dr, err := cm.GetNodesDeployCapacityWithDiagnostics(ctx, []string{"xxx", nodes[0]}, req, false, false)
+	assert.Nil(t, err)
+	assert.Len(t, dr.NodeDeployCapacityMap, 1)
+	assert.Equal(t, []*types.NodeDiagnostic{{Nodename: "xxx", Problem: types.DiagnosticNotFound}}, dr.Diagnostics)
+	_, err = cm.GetNodesDeployCapacityWithDiagnostics(ctx, []string{"xxx", nodes[0]}, req, true, false)
+	assert.True(t, errors.Is(err, types.ErrUnavailableNodes))
+
 	// normal
 	// 1. empty request
 	r, err = cm.GetNodesDeployCapacity(ctx, nodes, nil)
@@ -566,6 +597,54 @@ func TestSetNodeResourceUsage(t *testing.T) {
 
 }
 
+func TestSetNodeResourceUsageConcurrently(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	nodes := generateNodes(ctx, t, cm, 1, 0)
+	node := nodes[0]
+
+	workloadsResource := []plugintypes.WorkloadResource{
+		{
+			"prod_count_map": types.ProdCountMap{
+				"nvidia-3070": 1,
+			},
+		},
+	}
+
+	// without compare-and-swap some of the increments would be overwritten
+	n := 8
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cm.SetNodeResourceUsage(ctx, node, nil, nil, workloadsResource, true, true)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	info, err := cm.doGetNodeResourceInfo(ctx, node)
+	assert.Nil(t, err)
+	assert.Equal(t, n, info.Usage.ProdCountMap["nvidia-3070"])
+
+	// the write is rejected if the node is modified after read
+	nodeResourceInfo, revision, err := cm.doGetNodeResourceInfoWithRevision(ctx, node)
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, workloadsResource, true, false)
+	assert.Nil(t, err)
+	ok, err := cm.doCompareAndSetNodeResourceInfo(ctx, node, nodeResourceInfo, revision)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// the conflict error is returned if the node keeps changing
+	_, err = cm.updateNodeResourceInfo(ctx, node, func(nodeResourceInfo *types.NodeResourceInfo) (bool, error) {
+		_, err := cm.SetNodeResourceUsage(ctx, node, nil, nil, workloadsResource, true, true)
+		return true, err
+	})
+	assert.True(t, errors.Is(err, types.ErrConflict))
+}
+
 func TestGetMostIdleNode(t *testing.T) {
 	ctx := context.Background()
 	cm := initGPU(ctx, t)
@@ -583,8 +662,233 @@ func TestGetMostIdleNode(t *testing.T) {
 	r, err := cm.GetMostIdleNode(ctx, nodes)
 	assert.Nil(t, err)
 	assert.Equal(t, r.Nodename, nodes[0])
+	// the priority is derived from the idleness of the node chosen
+	assert.Equal(t, 100, r.Priority)
 
 	nodes = append(nodes, "node-x")
 	_, err = cm.GetMostIdleNode(ctx, nodes)
 	assert.Error(t, err)
+	_, err = cm.GetMostIdleNodeWithDiagnostics(ctx, nodes, true)
+	assert.True(t, errors.Is(err, types.ErrUnavailableNodes))
+	_, err = cm.GetMostIdleNode(ctx, []string{"node-x"})
+	assert.True(t, errors.Is(err, types.ErrUnavailableNodes))
+
+	// the nodes not found are only skipped if allowed by config
+	cm.gpuConfig.Scheduler.SkipUnavailable = true
+	r, err = cm.GetMostIdleNode(ctx, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, r.Nodename, nodes[0])
+	_, err = cm.GetNodesDeployCapacity(ctx, nodes, nil)
+	assert.Nil(t, err)
+}
+
+func TestScarcityWeightedIdleness(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMap("nvidia-3070", 8, 0)
+	gpuMap.Add(generateGPUMap("nvidia-h100", 1, 8))
+	busy := generateNodeWithGPUMap(ctx, t, cm, "test-scarce", gpuMap)
+	half := generateNodeWithGPUMap(ctx, t, cm, "test-common", generateGPUMap("nvidia-3070", 4, 0))
+	for node, count := range map[string]int{busy: 8, half: 2} {
+		d, err := cm.CalculateDeploy(ctx, node, count, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+		assert.Nil(t, err)
+		_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+		assert.Nil(t, err)
+	}
+
+	// the only H100 of the nodes weighs 13 times of a 3070, so the node with it is more idle,
+	// the nodes not to choose from are not counted
+	generateNodeWithGPUMap(ctx, t, cm, "test-plenty", generateGPUMap("nvidia-h100", 8, 8))
+	r, err := cm.GetMostIdleNode(ctx, []string{busy, half})
+	assert.Nil(t, err)
+	assert.Equal(t, busy, r.Nodename)
+	assert.Equal(t, 60, r.Priority)
+
+	// the weights in catalog take precedence
+	cm.gpuConfig = &types.Config{Products: map[string]types.ProductInfo{
+		"nvidia-3070": {Weight: 1},
+		"nvidia-h100": {Weight: 1},
+	}}
+	r, err = cm.GetMostIdleNode(ctx, []string{busy, half})
+	assert.Nil(t, err)
+	assert.Equal(t, half, r.Nodename)
+	assert.Equal(t, 50, r.Priority)
+
+	// the node without GPU is never the most idle one
+	empty := generateNodeWithGPUMap(ctx, t, cm, "test-empty", types.GPUMap{})
+	r, err = cm.GetMostIdleNode(ctx, []string{busy, half, empty})
+	assert.Nil(t, err)
+	assert.Equal(t, half, r.Nodename)
+	assert.ErrorIs(t, (&types.Config{Products: map[string]types.ProductInfo{"nvidia-h100": {Weight: -1}}}).Validate(), types.ErrInvalidConfig)
+}
+
+func TestNodeDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	nodes := generateNodes(ctx, t, cm, 1, 0)
+	empty := generateNodeWithGPUMap(ctx, t, cm, "test-empty", types.GPUMap{})
+	assert.Nil(t, cm.store.Put(ctx, fmt.Sprintf(nodeResourceInfoKey, "test-corrupt"), "{"))
+	nodenames := append(nodes, empty, "test-corrupt", "test-unknown", "test-unknown")
+
+	r, err := cm.GetMostIdleNodeWithDiagnostics(ctx, nodenames, false)
+	assert.Nil(t, err)
+	assert.Len(t, r.Diagnostics, 3)
+	assert.Equal(t, "test-corrupt", r.Diagnostics[0].Nodename)
+	assert.Equal(t, types.DiagnosticCorrupt, r.Diagnostics[0].Problem)
+	assert.Equal(t, &types.NodeDiagnostic{Nodename: empty, Problem: types.DiagnosticZeroCapacity}, r.Diagnostics[1])
+	assert.Equal(t, &types.NodeDiagnostic{Nodename: "test-unknown", Problem: types.DiagnosticNotFound}, r.Diagnostics[2])
+
+	// the strict mode can be set by config
+	cm.gpuConfig = &types.Config{Scheduler: types.SchedulerConfig{Strict: true}}
+	_, err = cm.GetNodesDeployCapacity(ctx, nodenames, plugintypes.WorkloadResourceRequest{})
+	assert.True(t, errors.Is(err, types.ErrUnavailableNodes))
+	_, err = cm.GetNodesDeployCapacity(ctx, nodes, plugintypes.WorkloadResourceRequest{})
+	assert.Nil(t, err)
+
+	// the node without GPU is only a problem for the requests of GPU
+	r2, err := cm.GetNodesDeployCapacity(ctx, []string{empty}, plugintypes.WorkloadResourceRequest{})
+	assert.Nil(t, err)
+	assert.Contains(t, r2.NodeDeployCapacityMap, empty)
+	_, err = cm.GetNodesDeployCapacity(ctx, []string{empty}, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+	assert.True(t, errors.Is(err, types.ErrUnavailableNodes))
+	assert.Nil(t, cm.store.Delete(ctx, fmt.Sprintf(nodeResourceInfoKey, "test-corrupt")))
+}
+
+func TestExplainDeployCapacity(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	gpuMap := generateGPUMap("nvidia-3070", 4, 0)
+	gpuMap.Add(generateGPUMap("nvidia-4090", 2, 4))
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-explain", gpuMap)
+	nodeWithout4090 := generateNodeWithGPUMap(ctx, t, cm, "test-explain-3070", generateGPUMap("nvidia-3070", 4, 0))
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 1,
+			"nvidia-4090": 1,
+		},
+	}
+	r, err := cm.GetNodesDeployCapacityWithDiagnostics(ctx, []string{node, nodeWithout4090}, req, false, false)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Explanations)
+
+	r, err = cm.GetNodesDeployCapacityWithDiagnostics(ctx, []string{node, nodeWithout4090}, req, false, true)
+	assert.Nil(t, err)
+	assert.Len(t, r.NodeDeployCapacityMap, 1)
+	assert.Len(t, r.Explanations, 2)
+	assert.Equal(t, &types.NodeExplanation{
+		Nodename: node,
+		Capacity: 2,
+		Products: []*types.ProdExplanation{
+			{Product: "nvidia-3070", Kind: types.ExplainCount, Requested: 1, Available: 4, Capacity: 4},
+			{Product: "nvidia-4090", Kind: types.ExplainCount, Requested: 1, Available: 2, Capacity: 2},
+		},
+		Limit: "nvidia-4090",
+	}, r.Explanations[node])
+	// the node left out is explained too
+	assert.Equal(t, 0, r.Explanations[nodeWithout4090].Capacity)
+	assert.Equal(t, "nvidia-4090", r.Explanations[nodeWithout4090].Limit)
+
+	// so are the failures of deployment
+	_, err = cm.CalculateDeploy(ctx, node, 3, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+	e := &types.InsufficientResourceError{}
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, 3, e.DeployCount)
+	assert.Equal(t, r.Explanations[node], e.Explanation)
+	assert.Contains(t, err.Error(), "limited by count nvidia-4090 (requested 1, available 2)")
+}
+
+func TestPlacementStrategy(t *testing.T) {
+	ctx := context.Background()
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+	}
+	for _, tc := range []struct {
+		strategy string
+		usage    [2]float64
+		rate     float64
+		idle     int
+	}{
+		{"", [2]float64{0, 0.25}, 0.125, 0},
+		{types.StrategySpread, [2]float64{0, 0.25}, 0.125, 0},
+		{types.StrategyBinpack, [2]float64{1, 0.75}, -0.125, 1},
+		{types.StrategyBestfit, [2]float64{0.5, 0.25}, -0.125, 1},
+	} {
+		tc := tc
+		t.Run(tc.strategy, func(t *testing.T) {
+			cm := initGPUWithConfig(ctx, t, &types.Config{
+				Scheduler: types.SchedulerConfig{Strategy: tc.strategy, Weight: 2},
+			})
+			nodes := generateNodes(ctx, t, cm, 3, 0)
+			sort.Strings(nodes)
+			_, err := cm.SetNodeResourceUsage(ctx, nodes[1], nil, plugintypes.NodeResourceRequest{
+				"prod_count_map": types.ProdCountMap{"nvidia-3070": 2},
+			}, nil, false, false)
+			assert.Nil(t, err)
+			// the full node is never the most idle one
+			_, err = cm.SetNodeResourceUsage(ctx, nodes[2], nil, plugintypes.NodeResourceRequest{
+				"prod_count_map": types.ProdCountMap{"nvidia-3070": 4, "nvidia-3090": 4},
+			}, nil, false, false)
+			assert.Nil(t, err)
+
+			r, err := cm.GetNodesDeployCapacity(ctx, nodes, req)
+			assert.Nil(t, err)
+			assert.Equal(t, 6, r.Total)
+			for i := range tc.usage {
+				capacityInfo := r.NodeDeployCapacityMap[nodes[i]]
+				assert.Equal(t, float64(2), capacityInfo.Weight)
+				assert.InDelta(t, tc.usage[i], capacityInfo.Usage, 0.0001, tc.strategy)
+				assert.InDelta(t, tc.rate, capacityInfo.Rate, 0.0001, tc.strategy)
+			}
+
+			ir, err := cm.GetMostIdleNode(ctx, nodes)
+			assert.Nil(t, err)
+			assert.Equal(t, nodes[tc.idle], ir.Nodename, tc.strategy)
+		})
+	}
+
+	_, err := NewPlugin(ctx, coretypes.Config{}, &types.Config{
+		Scheduler: types.SchedulerConfig{Strategy: "random"},
+	})
+	assert.True(t, errors.Is(err, types.ErrInvalidConfig))
+}
+
+func TestGetAndFixNodeResourceInfoWithGPUMap(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-gpu-map", generateGPUMap("nvidia-3070", 2, 0))
+
+	r, err := cm.GetNodeResourceInfo(ctx, node, nil)
+	assert.Nil(t, err)
+	capacity := &types.NodeResource{}
+	assert.Nil(t, capacity.Parse(r.Capacity))
+	assert.Equal(t, 2, capacity.Count())
+	assert.Len(t, capacity.GPUMap, 2)
+
+	// two workloads hold the same device
+	workloadsResource := []plugintypes.WorkloadResource{
+		{
+			"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+			"addr_count_map": types.AddrCountMap{"0000:00:00.0": 1},
+		},
+		{
+			"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+			"addr_count_map": types.AddrCountMap{"0000:00:00.0": 1},
+		},
+	}
+	r, err = cm.GetNodeResourceInfo(ctx, node, workloadsResource)
+	assert.Nil(t, err)
+	assert.Contains(t, r.Diffs, "0000:00:00.0 is held by 2 workloads")
+
+	// fix with valid workloads
+	r, err = cm.FixNodeResource(ctx, node, workloadsResource[:1])
+	assert.Nil(t, err)
+	usage := &types.NodeResource{}
+	assert.Nil(t, usage.Parse(r.Usage))
+	assert.Equal(t, types.AddrCountMap{"0000:00:00.0": 1}, usage.AddrCountMap)
+
+	r, err = cm.GetNodeResourceInfo(ctx, node, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, r.Diffs, "0000:00:00.0 is not held by any workload")
 }
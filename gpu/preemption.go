@@ -0,0 +1,84 @@
+package gpu
+
+import (
+	"context"
+	"sort"
+
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// doPlanPreemption returns a small set of workloads with lower priority to be evicted from node so the request can fit,
+// the set is chosen greedily so it's not always the fewest.
+// nil will be returned if the request can't fit even if all of them are evicted.
+// The workloads deployed by reservations are never chosen, the GPUs they release are still set aside for the reservations.
+func (p Plugin) doPlanPreemption(ctx context.Context, nodename string, nodeResourceInfo *gputypes.NodeResourceInfo, deployCount int, req *gputypes.WorkloadResourceRequest) (*gputypes.PreemptionPlan, error) {
+	allocations, err := p.doGetAllocations(ctx, nodename)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []*gputypes.WorkloadResource{}
+	for _, allocation := range allocations {
+		if allocation.Priority < req.Priority && allocation.ReservationID == "" {
+			candidates = append(candidates, allocation)
+		}
+	}
+	// the workloads with the lowest priority are evicted first, then the larger ones to evict fewer workloads
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		if candidates[i].Count() != candidates[j].Count() {
+			return candidates[i].Count() > candidates[j].Count()
+		}
+		return candidates[i].AllocID < candidates[j].AllocID
+	})
+
+	fits := func(victims []*gputypes.WorkloadResource) bool {
+		info := nodeResourceInfo.DeepCopy()
+		for _, victim := range victims {
+			info.Usage.Sub(&gputypes.NodeResource{
+				ProdCountMap: victim.ProdCountMap,
+				AddrCountMap: victim.AddrCountMap,
+				VRAMMap:      victim.VRAMMap,
+				MIGCountMap:  victim.MIGCountMap,
+			})
+		}
+		for _, altReq := range req.Expand() {
+			if _, _, err := p.doAlloc(info, deployCount, altReq, nil); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	victims := []*gputypes.WorkloadResource{}
+	for _, candidate := range candidates {
+		victims = append(victims, candidate)
+		if fits(victims) {
+			break
+		}
+	}
+	if len(victims) == 0 || !fits(victims) {
+		return nil, nil
+	}
+	// the victims chosen earlier may be unnecessary after the larger ones are chosen,
+	// try to keep them from the one with the highest priority
+	for i := len(victims) - 1; i >= 0; i-- {
+		rest := append(append([]*gputypes.WorkloadResource{}, victims[:i]...), victims[i+1:]...)
+		if fits(rest) {
+			victims = rest
+		}
+	}
+
+	plan := &gputypes.PreemptionPlan{Nodename: nodename, Priority: req.Priority, Freed: gputypes.ProdCountMap{}}
+	for _, victim := range victims {
+		plan.Victims = append(plan.Victims, &gputypes.PreemptionVictim{
+			AllocID:      victim.AllocID,
+			Tenant:       victim.Tenant,
+			Priority:     victim.Priority,
+			ProdCountMap: victim.ProdCountMap.DeepCopy(),
+		})
+		plan.Freed.Add(victim.ProdCountMap)
+	}
+	return plan, nil
+}
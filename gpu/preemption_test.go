@@ -0,0 +1,84 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestPreemption(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-preemption", generateGPUMap("nvidia-3070", 4, 0))
+
+	deploy := func(count, priority int) *types.WorkloadResource {
+		d, err := cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{
+			"prod_count_map": types.ProdCountMap{"nvidia-3070": count},
+			"priority":       priority,
+		})
+		assert.Nil(t, err)
+		_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+		assert.Nil(t, err)
+		wr := &types.WorkloadResource{}
+		assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+		return wr
+	}
+	small := deploy(1, 1)
+	large := deploy(2, 1)
+	important := deploy(1, 5)
+
+	allocations, err := cm.doGetAllocations(ctx, node)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, allocations[important.AllocID].Priority)
+
+	_, err = cm.CalculateDeploy(ctx, node, 1, plugintypes.WorkloadResourceRequest{"priority": -1})
+	assert.ErrorIs(t, err, types.ErrInvalidPriority)
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 2},
+		"priority":       3,
+	}
+	// no plan unless it's asked for
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+	assert.False(t, errors.HasType(err, &types.PreemptionRequiredError{}))
+
+	// evicting the larger one is enough
+	req["preempt"] = true
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+	preemption := &types.PreemptionRequiredError{}
+	assert.True(t, errors.As(err, &preemption))
+	assert.Equal(t, 1, len(preemption.Plan.Victims))
+	assert.Equal(t, large.AllocID, preemption.Plan.Victims[0].AllocID)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 2}, preemption.Plan.Freed)
+	insufficient := &types.InsufficientResourceError{}
+	assert.True(t, errors.As(err, &insufficient))
+
+	// the workloads with higher priority are never evicted
+	req["prod_count_map"] = types.ProdCountMap{"nvidia-3070": 4}
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+	assert.False(t, errors.HasType(err, &types.PreemptionRequiredError{}))
+
+	req["priority"] = 10
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.True(t, errors.As(err, &preemption))
+	victims := []string{}
+	for _, victim := range preemption.Plan.Victims {
+		victims = append(victims, victim.AllocID)
+	}
+	assert.ElementsMatch(t, []string{small.AllocID, large.AllocID, important.AllocID}, victims)
+
+	// the priority is kept across realloc
+	r, err := cm.CalculateRealloc(ctx, node, important.AsRawParams(), plugintypes.WorkloadResourceRequest{})
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(r.WorkloadResource))
+	assert.Equal(t, 5, wr.Priority)
+}
@@ -0,0 +1,161 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/log"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// provisionalEnabled returns true if CalculateDeploy reserves the GPUs it plans
+func (p Plugin) provisionalEnabled() bool {
+	return p.gpuConfig.Provisional.TTL > 0
+}
+
+// doGetProvisionals returns the workloads resource reserved on each node under the prefix,
+// the expired reservations are dropped in case the storage has not removed them yet, e.g. the lease of etcd is revoked late.
+func (p Plugin) doGetProvisionals(ctx context.Context, prefix string) (map[string][]*gputypes.WorkloadResource, error) {
+	kvs, err := p.store.GetPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	provisionals := map[string][]*gputypes.WorkloadResource{}
+	for _, kv := range kvs {
+		reservation := &gputypes.ProvisionalReservation{}
+		if err := json.Unmarshal(kv.Value, reservation); err != nil {
+			return nil, err
+		}
+		if reservation.Resource == nil || reservation.Expired(now) {
+			if err := p.store.Delete(ctx, kv.Key); err != nil {
+				log.WithFunc("resource.gpu.doGetProvisionals").Warnf(ctx, "failed to delete expired reservation %s: %+v", kv.Key, err)
+			}
+			continue
+		}
+		// the key is provisionalRoot + nodename/allocID
+		nodename := strings.SplitN(strings.TrimPrefix(kv.Key, provisionalRoot), "/", 2)[0]
+		provisionals[nodename] = append(provisionals[nodename], reservation.Resource.DeepCopy())
+	}
+	return provisionals, nil
+}
+
+// applyProvisionals counts the reserved resource as usage, so it's not available for others
+func (p Plugin) applyProvisionals(nodeResourceInfo *gputypes.NodeResourceInfo, provisionals []*gputypes.WorkloadResource) {
+	if len(provisionals) > 0 {
+		nodeResourceInfo.Usage = p.incrUpdateNodeResource(nil, nil, nodeResourceInfo.Usage, provisionals, true)
+	}
+}
+
+// doApplyNodesProvisionals counts the reservations on each of the nodes as usage
+func (p Plugin) doApplyNodesProvisionals(ctx context.Context, nodesResourceInfo map[string]*gputypes.NodeResourceInfo) error {
+	if !p.provisionalEnabled() {
+		return nil
+	}
+	provisionals, err := p.doGetProvisionals(ctx, provisionalRoot)
+	if err != nil {
+		return err
+	}
+	for nodename, nodeResourceInfo := range nodesResourceInfo {
+		p.applyProvisionals(nodeResourceInfo, provisionals[nodename])
+	}
+	return nil
+}
+
+// doGetNodeResourceInfoWithProvisionals returns the resource info of node with the reservations counted as usage,
+// and the revision of the seq key of reservations which is required to reserve.
+// The seq key and the reservations are read before the resource info, so a reservation confirmed meanwhile
+// may be counted twice but never missed.
+func (p Plugin) doGetNodeResourceInfoWithProvisionals(ctx context.Context, nodename string) (*gputypes.NodeResourceInfo, int64, error) {
+	if !p.provisionalEnabled() {
+		nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
+		return nodeResourceInfo, 0, err
+	}
+	var revision int64
+	kv, err := p.store.Get(ctx, fmt.Sprintf(provisionalSeqKey, nodename))
+	switch {
+	case err == nil:
+		revision = kv.Revision
+	case !errors.Is(err, store.ErrKeyNotExists):
+		return nil, 0, err
+	}
+	provisionals, err := p.doGetProvisionals(ctx, fmt.Sprintf(provisionalPrefix, nodename))
+	if err != nil {
+		return nil, 0, err
+	}
+	nodeResourceInfo, err := p.doGetNodeResourceInfo(ctx, nodename)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.applyProvisionals(nodeResourceInfo, provisionals[nodename])
+	return nodeResourceInfo, revision, nil
+}
+
+// doReserveProvisionals reserves the workloads resource for TTL, returns false if another reservation
+// was made on the node after revision, in that case nothing is reserved and the plan should be recalculated.
+func (p Plugin) doReserveProvisionals(ctx context.Context, nodename string, workloadsResource []*gputypes.WorkloadResource, revision int64) (bool, error) {
+	ttl := p.gpuConfig.Provisional.TTL
+	keys := []string{}
+	release := func() {
+		for _, key := range keys {
+			if err := p.store.Delete(ctx, key); err != nil {
+				log.WithFunc("resource.gpu.doReserveProvisionals").Warnf(ctx, "failed to release reservation %s: %+v", key, err)
+			}
+		}
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	for _, workloadResource := range workloadsResource {
+		data, err := json.Marshal(&gputypes.ProvisionalReservation{Resource: workloadResource, ExpiresAt: expiresAt})
+		if err != nil {
+			release()
+			return false, err
+		}
+		key := fmt.Sprintf(provisionalKey, nodename, workloadResource.AllocID)
+		if err := p.store.PutWithTTL(ctx, key, string(data), ttl); err != nil {
+			release()
+			return false, err
+		}
+		keys = append(keys, key)
+	}
+	// the reservations are put before swapping, so whoever reads the new seq sees them
+	ok, err := p.store.CompareAndSwap(ctx, fmt.Sprintf(provisionalSeqKey, nodename), strconv.FormatInt(time.Now().UnixNano(), 10), revision)
+	if err != nil || !ok {
+		release()
+	}
+	return ok, err
+}
+
+// doConfirmProvisionals drops the reservations of the workloads whose usage is set
+func (p Plugin) doConfirmProvisionals(ctx context.Context, nodename string, workloadsResource []*gputypes.WorkloadResource) error {
+	for _, workloadResource := range workloadsResource {
+		if workloadResource.AllocID == "" {
+			continue
+		}
+		if err := p.store.Delete(ctx, fmt.Sprintf(provisionalKey, nodename, workloadResource.AllocID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doRemoveProvisionals removes the reservations and the sequence of node,
+// they are removed even if disabled, since they may be left by an earlier config.
+func (p Plugin) doRemoveProvisionals(ctx context.Context, nodename string) error {
+	kvs, err := p.store.GetPrefix(ctx, fmt.Sprintf(provisionalPrefix, nodename))
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if err := p.store.Delete(ctx, kv.Key); err != nil {
+			return err
+		}
+	}
+	return p.store.Delete(ctx, fmt.Sprintf(provisionalSeqKey, nodename))
+}
@@ -0,0 +1,70 @@
+package gpu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestProvisionalReservations(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{Provisional: types.ProvisionalConfig{TTL: time.Second}})
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-provisional", generateGPUMap("nvidia-3070", 4, 0))
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{
+			"nvidia-3070": 2,
+		},
+	}
+	capacityOf := func() int {
+		r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+		assert.Nil(t, err)
+		return r.Total
+	}
+
+	// the GPUs planned are reserved until the usage is set
+	d1, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, capacityOf())
+	_, err = cm.CalculateDeploy(ctx, node, 2, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+	d2, err := cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	wr1, wr2 := &types.WorkloadResource{}, &types.WorkloadResource{}
+	assert.Nil(t, wr1.Parse(d1.WorkloadsResource[0]))
+	assert.Nil(t, wr2.Parse(d2.WorkloadsResource[0]))
+	for addr := range wr1.AddrCountMap {
+		assert.NotContains(t, wr2.AddrCountMap, addr)
+	}
+	assert.Equal(t, 0, capacityOf())
+
+	// the usage confirms the reservation
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d1.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	_, err = cm.store.Get(ctx, fmt.Sprintf(provisionalKey, node, wr1.AllocID))
+	assert.Error(t, err)
+	assert.Equal(t, 0, capacityOf())
+
+	// the reservation not confirmed is released after TTL
+	assert.Eventually(t, func() bool { return capacityOf() == 1 }, 10*time.Second, 100*time.Millisecond)
+
+	// nothing is reserved if another reservation was made meanwhile
+	nodeResourceInfo, revision, err := cm.doGetNodeResourceInfoWithProvisionals(ctx, node)
+	assert.Nil(t, err)
+	_, workloadsResource, err := cm.doCalculateDeploy(node, nodeResourceInfo, 1, &types.WorkloadResourceRequest{ProdCountMap: types.ProdCountMap{"nvidia-3070": 2}})
+	assert.Nil(t, err)
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	ok, err := cm.doReserveProvisionals(ctx, node, workloadsResource, revision)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = cm.store.Get(ctx, fmt.Sprintf(provisionalKey, node, workloadsResource[0].AllocID))
+	assert.Error(t, err)
+	assert.Equal(t, 0, capacityOf())
+}
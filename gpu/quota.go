@@ -0,0 +1,248 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/utils"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// SetQuota sets the limit of tenant, the usage of tenant is kept
+func (p Plugin) SetQuota(ctx context.Context, tenant string, limit gputypes.ProdCountMap) error {
+	quota := &gputypes.Quota{Tenant: tenant, Limit: limit}
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	return p.updateQuotas(ctx, func(quotas map[string]gputypes.ProdCountMap) error {
+		quotas[tenant] = limit.DeepCopy()
+		return nil
+	})
+}
+
+// DeleteQuota removes the limit of tenant
+func (p Plugin) DeleteQuota(ctx context.Context, tenant string) error {
+	return p.updateQuotas(ctx, func(quotas map[string]gputypes.ProdCountMap) error {
+		if _, ok := quotas[tenant]; !ok {
+			return errors.Wrapf(gputypes.ErrQuotaNotExists, "tenant: %s", tenant)
+		}
+		delete(quotas, tenant)
+		return nil
+	})
+}
+
+// ListQuotas returns the quotas with the current usage of tenants, ordered by tenant
+func (p Plugin) ListQuotas(ctx context.Context) ([]*gputypes.Quota, error) {
+	quotas, _, err := p.doGetQuotas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := []*gputypes.Quota{}
+	for tenant, limit := range quotas {
+		usage, _, err := p.doGetTenantUsage(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &gputypes.Quota{Tenant: tenant, Limit: limit, Usage: usage})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Tenant < res[j].Tenant })
+	return res, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if the tenant would exceed its quota after holding incr more,
+// the tenant without quota is not limited. The usage is only updated when eru-core sets the usage,
+// so the provisional reservations of tenant are counted as well, except reserved which are held for incr.
+// The caller reserves before checking, so of two deployments racing for the last GPUs, none passes unnoticed.
+func (p Plugin) checkQuota(ctx context.Context, tenant string, incr gputypes.ProdCountMap, reserved []*gputypes.WorkloadResource) error {
+	if tenant == "" {
+		return nil
+	}
+	quotas, _, err := p.doGetQuotas(ctx)
+	if err != nil {
+		return err
+	}
+	limit, ok := quotas[tenant]
+	if !ok {
+		return nil
+	}
+	usage, _, err := p.doGetTenantUsage(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	if p.provisionalEnabled() {
+		provisionals, err := p.doGetProvisionals(ctx, provisionalRoot)
+		if err != nil {
+			return err
+		}
+		held := map[string]bool{}
+		for _, workloadResource := range reserved {
+			held[workloadResource.AllocID] = true
+		}
+		for _, nodeProvisionals := range provisionals {
+			for _, provisional := range nodeProvisionals {
+				if provisional.Tenant == tenant && !held[provisional.AllocID] {
+					usage.Add(provisional.ProdCountMap)
+				}
+			}
+		}
+	}
+	return (&gputypes.Quota{Tenant: tenant, Limit: limit, Usage: usage}).Check(incr)
+}
+
+// doGetQuotas returns the limits by tenant and the revision of the key
+func (p Plugin) doGetQuotas(ctx context.Context) (map[string]gputypes.ProdCountMap, int64, error) {
+	quotas := map[string]gputypes.ProdCountMap{}
+	kv, err := p.store.Get(ctx, quotasKey)
+	if errors.Is(err, store.ErrKeyNotExists) {
+		return quotas, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := json.Unmarshal(kv.Value, &quotas); err != nil {
+		return nil, 0, err
+	}
+	return quotas, kv.Revision, nil
+}
+
+func (p Plugin) updateQuotas(ctx context.Context, update func(map[string]gputypes.ProdCountMap) error) error {
+	for i := 0; i < maxCASRetries; i++ {
+		quotas, revision, err := p.doGetQuotas(ctx)
+		if err != nil {
+			return err
+		}
+		if err := update(quotas); err != nil {
+			return err
+		}
+		data, err := json.Marshal(quotas)
+		if err != nil {
+			return err
+		}
+		ok, err := p.store.CompareAndSwap(ctx, quotasKey, string(data), revision)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "quotas, retried %d times", maxCASRetries)
+}
+
+// doGetTenantUsage returns the GPUs held by the workloads of tenant cluster-wide and the revision of the key
+func (p Plugin) doGetTenantUsage(ctx context.Context, tenant string) (gputypes.ProdCountMap, int64, error) {
+	usage := gputypes.ProdCountMap{}
+	kv, err := p.store.Get(ctx, fmt.Sprintf(tenantUsageKey, tenant))
+	if errors.Is(err, store.ErrKeyNotExists) {
+		return usage, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := json.Unmarshal(kv.Value, &usage); err != nil {
+		return nil, 0, err
+	}
+	return usage, kv.Revision, nil
+}
+
+// doUpdateTenantsUsage applies the workloads resource set to usage to the usage of their tenants,
+// the workloads resource may be the whole resource of workloads or the delta of realloc.
+func (p Plugin) doUpdateTenantsUsage(ctx context.Context, workloadsResource []*gputypes.WorkloadResource, incr bool) error {
+	deltas := map[string]gputypes.ProdCountMap{}
+	for _, workloadResource := range workloadsResource {
+		if workloadResource.Tenant == "" {
+			continue
+		}
+		if _, ok := deltas[workloadResource.Tenant]; !ok {
+			deltas[workloadResource.Tenant] = gputypes.ProdCountMap{}
+		}
+		deltas[workloadResource.Tenant].Add(workloadResource.ProdCountMap)
+	}
+	for tenant, delta := range deltas {
+		if err := p.doUpdateTenantUsage(ctx, tenant, delta, incr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p Plugin) doUpdateTenantUsage(ctx context.Context, tenant string, delta gputypes.ProdCountMap, incr bool) error {
+	key := fmt.Sprintf(tenantUsageKey, tenant)
+	for i := 0; i < maxCASRetries; i++ {
+		usage, revision, err := p.doGetTenantUsage(ctx, tenant)
+		if err != nil {
+			return err
+		}
+		if incr {
+			usage.Add(delta)
+		} else {
+			usage.Sub(delta)
+		}
+		usage.RemoveLTE0()
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		ok, err := p.store.CompareAndSwap(ctx, key, string(data), revision)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "usage of tenant: %s, retried %d times", tenant, maxCASRetries)
+}
+
+// RepairTenantsUsage rebuilds the usage of all tenants from the records of allocations,
+// e.g. after an update of the usage of tenants failed. All the records of cluster are read,
+// so it's only done on demand, the writes of records keep the usage by deltas.
+func (p Plugin) RepairTenantsUsage(ctx context.Context) error {
+	for i := 0; i < maxCASRetries; i++ {
+		// the usage is read before the records, so a delta applied meanwhile fails the swap
+		kvs, err := p.store.GetPrefix(ctx, tenantUsageRoot)
+		if err != nil {
+			return err
+		}
+		revisions := map[string]int64{}
+		for _, kv := range kvs {
+			revisions[utils.Tail(kv.Key)] = kv.Revision
+		}
+		if kvs, err = p.store.GetPrefix(ctx, allocationRoot); err != nil {
+			return err
+		}
+		usages := map[string]gputypes.ProdCountMap{}
+		for tenant := range revisions {
+			usages[tenant] = gputypes.ProdCountMap{}
+		}
+		for _, kv := range kvs {
+			record, err := p.unmarshalAllocation(kv.Value)
+			if err != nil {
+				return err
+			}
+			if record.Tenant == "" {
+				continue
+			}
+			if _, ok := usages[record.Tenant]; !ok {
+				usages[record.Tenant] = gputypes.ProdCountMap{}
+			}
+			usages[record.Tenant].Add(record.ProdCountMap)
+		}
+
+		swapped := true
+		for tenant, usage := range usages {
+			usage.RemoveLTE0()
+			data, err := json.Marshal(usage)
+			if err != nil {
+				return err
+			}
+			ok, err := p.store.CompareAndSwap(ctx, fmt.Sprintf(tenantUsageKey, tenant), string(data), revisions[tenant])
+			if err != nil {
+				return err
+			}
+			swapped = swapped && ok
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "usage of tenants, retried %d times", maxCASRetries)
+}
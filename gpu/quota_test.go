@@ -0,0 +1,168 @@
+package gpu
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-quota", generateGPUMap("nvidia-3070", 8, 0))
+
+	assert.ErrorIs(t, cm.SetQuota(ctx, "", types.ProdCountMap{"nvidia-3070": 3}), types.ErrInvalidQuota)
+	assert.ErrorIs(t, cm.SetQuota(ctx, "team-vision", types.ProdCountMap{"nvidia-3070": -1}), types.ErrInvalidGPUMap)
+	assert.Nil(t, cm.SetQuota(ctx, "team-vision", types.ProdCountMap{"nvidia-3070": 3}))
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+		"tenant":         "team-vision",
+	}
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	quotas, err := cm.ListQuotas(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Quota{{Tenant: "team-vision", Limit: types.ProdCountMap{"nvidia-3070": 3}, Usage: types.ProdCountMap{"nvidia-3070": 2}}}, quotas)
+
+	_, err = cm.CalculateDeploy(ctx, node, 2, req)
+	assert.ErrorIs(t, err, types.ErrQuotaExceeded)
+	_, err = cm.CalculateDeploy(ctx, node, 1, req)
+	assert.Nil(t, err)
+	// the tenants without quota are not limited
+	req["tenant"] = "team-x"
+	_, err = cm.CalculateDeploy(ctx, node, 4, req)
+	assert.Nil(t, err)
+
+	// realloc is checked by the delta, and the workload keeps its tenant
+	r, err := cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 2}})
+	assert.ErrorIs(t, err, types.ErrQuotaExceeded)
+	assert.Nil(t, r)
+	r, err = cm.CalculateRealloc(ctx, node, d.WorkloadsResource[0], plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+	assert.Nil(t, err)
+	delta := &types.WorkloadResource{}
+	assert.Nil(t, delta.Parse(r.DeltaResource))
+	assert.Equal(t, "team-vision", delta.Tenant)
+
+	// the usage is released with the workloads
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource[:1], true, false)
+	assert.Nil(t, err)
+	quotas, err = cm.ListQuotas(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 1}, quotas[0].Usage)
+
+	assert.Nil(t, cm.DeleteQuota(ctx, "team-vision"))
+	assert.ErrorIs(t, cm.DeleteQuota(ctx, "team-vision"), types.ErrQuotaNotExists)
+	req["tenant"] = "team-vision"
+	_, err = cm.CalculateDeploy(ctx, node, 4, req)
+	assert.Nil(t, err)
+}
+
+func TestTenantsUsageFollowsRecords(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node1 := generateNodeWithGPUMap(ctx, t, cm, "test-tenant-1", generateGPUMap("nvidia-3070", 4, 0))
+	node2 := generateNodeWithGPUMap(ctx, t, cm, "test-tenant-2", generateGPUMap("nvidia-3070", 4, 0))
+	assert.Nil(t, cm.SetQuota(ctx, "team-a", types.ProdCountMap{"nvidia-3070": 8}))
+	t.Cleanup(func() { assert.Nil(t, cm.DeleteQuota(ctx, "team-a")) })
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+		"tenant":         "team-a",
+	}
+	d1, err := cm.CalculateDeploy(ctx, node1, 2, req)
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node1, nil, nil, d1.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	d2, err := cm.CalculateDeploy(ctx, node2, 1, req)
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node2, nil, nil, d2.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	usage := func() types.ProdCountMap {
+		quotas, err := cm.ListQuotas(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, quotas, 1)
+		return quotas[0].Usage
+	}
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 3}, usage())
+
+	// the workloads go with the node
+	_, err = cm.RemoveNode(ctx, node1)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 1}, usage())
+
+	// the workloads are gone in eru-core
+	_, err = cm.FixNodeResource(ctx, node2, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ProdCountMap{}, usage())
+
+	// the usage is set to the workloads on node
+	_, err = cm.SetNodeResourceUsage(ctx, node2, nil, nil, d2.WorkloadsResource, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 1}, usage())
+
+	// the usage lost is rebuilt from the records on demand
+	assert.Nil(t, cm.store.Put(ctx, fmt.Sprintf(tenantUsageKey, "team-a"), "{}"))
+	assert.Equal(t, types.ProdCountMap{}, usage())
+	assert.Nil(t, cm.RepairTenantsUsage(ctx))
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 1}, usage())
+}
+
+func TestQuotaWithProvisionals(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{Provisional: types.ProvisionalConfig{TTL: time.Minute}})
+	nodes := []string{}
+	for i := 0; i < 4; i++ {
+		nodes = append(nodes, generateNodeWithGPUMap(ctx, t, cm, fmt.Sprintf("test-quota-provisional-%d", i), generateGPUMap("nvidia-3070", 4, 0)))
+	}
+	assert.Nil(t, cm.SetQuota(ctx, "team-a", types.ProdCountMap{"nvidia-3070": 2}))
+	t.Cleanup(func() { assert.Nil(t, cm.DeleteQuota(ctx, "team-a")) })
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+		"tenant":         "team-a",
+	}
+
+	// the deployments in progress are counted
+	d, err := cm.CalculateDeploy(ctx, nodes[0], 2, req)
+	assert.Nil(t, err)
+	_, err = cm.CalculateDeploy(ctx, nodes[1], 1, req)
+	assert.ErrorIs(t, err, types.ErrQuotaExceeded)
+	// and the reservations of the rejected one are released
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{nodes[1]}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, r.Total)
+	_, err = cm.SetNodeResourceUsage(ctx, nodes[0], nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	_, err = cm.CalculateDeploy(ctx, nodes[1], 1, req)
+	assert.ErrorIs(t, err, types.ErrQuotaExceeded)
+	_, err = cm.SetNodeResourceUsage(ctx, nodes[0], nil, nil, d.WorkloadsResource, true, false)
+	assert.Nil(t, err)
+
+	// the deployments racing for the quota never pass together
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	passed := 0
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			if _, err := cm.CalculateDeploy(ctx, node, 1, req); err == nil {
+				mutex.Lock()
+				passed++
+				mutex.Unlock()
+			} else {
+				assert.ErrorIs(t, err, types.ErrQuotaExceeded)
+			}
+		}(node)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, passed, 2)
+}
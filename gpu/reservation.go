@@ -0,0 +1,247 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/projecteru2/core/utils"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// CreateReservation sets aside GPUs for a tenant, the GPUs of the product can't be overbooked,
+// i.e. the reservations overlapping in time can't reserve more GPUs than the capacity of node.
+func (p Plugin) CreateReservation(ctx context.Context, req *gputypes.ReservationRequest) (*gputypes.Reservation, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if !p.gpuConfig.IsKnownProd(req.Product) {
+		return nil, errors.Wrapf(gputypes.ErrInvalidGPUProduct, "%s is not in catalog", req.Product)
+	}
+	nodenames := req.Nodes
+	if len(req.Pool) > 0 {
+		nodenames = req.Pool
+	}
+	nodesResourceInfo, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	if err != nil {
+		return nil, err
+	}
+	// the nodes without GPU just have nothing to reserve
+	if err := gputypes.DiagnosticsError(withoutZeroCapacity(diagnostics)); err != nil {
+		return nil, err
+	}
+
+	reservation := &gputypes.Reservation{
+		ID:      utils.RandomString(reservationIDLength),
+		Tenant:  req.Tenant,
+		Product: req.Product,
+		Start:   req.Start,
+		End:     req.End,
+	}
+	err = p.updateReservations(ctx, func(reservations map[string]*gputypes.Reservation) error {
+		// the GPUs of the product not booked by others during the window
+		spare := map[string]int{}
+		for nodename, nodeResourceInfo := range nodesResourceInfo {
+			spare[nodename] = nodeResourceInfo.Capacity.ProdCountMap[req.Product]
+		}
+		for _, r := range reservations {
+			if r.Product != req.Product || !r.Overlaps(req.Start, req.End) {
+				continue
+			}
+			for nodename, count := range r.NodeCountMap {
+				if _, ok := spare[nodename]; ok {
+					spare[nodename] -= count
+				}
+			}
+		}
+
+		reservation.NodeCountMap = map[string]int{}
+		if len(req.Nodes) > 0 {
+			for _, nodename := range req.Nodes {
+				if spare[nodename] < req.Count {
+					return errors.Wrapf(coretypes.ErrInsufficientResource, "node %s has %d %s not booked", nodename, utils.Max(spare[nodename], 0), req.Product)
+				}
+				reservation.NodeCountMap[nodename] = req.Count
+			}
+		} else {
+			// the nodes with more spare GPUs are filled first, so the reservation is spread over fewer nodes
+			pool := append([]string{}, req.Pool...)
+			sort.SliceStable(pool, func(i, j int) bool {
+				if spare[pool[i]] != spare[pool[j]] {
+					return spare[pool[i]] > spare[pool[j]]
+				}
+				return pool[i] < pool[j]
+			})
+			need := req.Count
+			for _, nodename := range pool {
+				if need == 0 || spare[nodename] <= 0 {
+					break
+				}
+				count := utils.Min(need, spare[nodename])
+				reservation.NodeCountMap[nodename] += count
+				need -= count
+			}
+			if need > 0 {
+				return errors.Wrapf(coretypes.ErrInsufficientResource, "pool has %d %s not booked", req.Count-need, req.Product)
+			}
+		}
+		reservations[reservation.ID] = reservation
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// ListReservations returns the reservations of tenant ordered by start time, all the reservations if tenant is empty
+func (p Plugin) ListReservations(ctx context.Context, tenant string) ([]*gputypes.Reservation, error) {
+	reservations, _, err := p.doGetReservations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := []*gputypes.Reservation{}
+	for _, reservation := range reservations {
+		if tenant == "" || reservation.Tenant == tenant {
+			res = append(res, reservation)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Start.Equal(res[j].Start) {
+			return res[i].Start.Before(res[j].Start)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// DeleteReservation releases the GPUs set aside, the workloads deployed by the reservation are kept
+func (p Plugin) DeleteReservation(ctx context.Context, id string) error {
+	return p.updateReservations(ctx, func(reservations map[string]*gputypes.Reservation) error {
+		if _, ok := reservations[id]; !ok {
+			return errors.Wrapf(gputypes.ErrReservationNotExists, "reservation: %s", id)
+		}
+		delete(reservations, id)
+		return nil
+	})
+}
+
+// doGetReservation returns the reservation of id, nil if it doesn't exist or has expired
+func (p Plugin) doGetReservation(ctx context.Context, id string) (*gputypes.Reservation, error) {
+	reservations, _, err := p.doGetReservations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return reservations[id], nil
+}
+
+// doGetReservations returns the reservations not expired by ID and the revision of the key,
+// the expired ones are left in the key until the next update prunes them.
+func (p Plugin) doGetReservations(ctx context.Context) (map[string]*gputypes.Reservation, int64, error) {
+	reservations := map[string]*gputypes.Reservation{}
+	kv, err := p.store.Get(ctx, reservationsKey)
+	if errors.Is(err, store.ErrKeyNotExists) {
+		return reservations, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := json.Unmarshal(kv.Value, &reservations); err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	for id, reservation := range reservations {
+		if reservation.Expired(now) {
+			delete(reservations, id)
+		}
+	}
+	return reservations, kv.Revision, nil
+}
+
+// updateReservations applies update to all the reservations, they are kept in a single key,
+// so the overbooking checks of concurrent updates can't race. The expired reservations are pruned.
+func (p Plugin) updateReservations(ctx context.Context, update func(map[string]*gputypes.Reservation) error) error {
+	for i := 0; i < maxCASRetries; i++ {
+		reservations, revision, err := p.doGetReservations(ctx)
+		if err != nil {
+			return err
+		}
+		if err := update(reservations); err != nil {
+			return err
+		}
+		data, err := json.Marshal(reservations)
+		if err != nil {
+			return err
+		}
+		ok, err := p.store.CompareAndSwap(ctx, reservationsKey, string(data), revision)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.Wrapf(gputypes.ErrConflict, "reservations, retried %d times", maxCASRetries)
+}
+
+// doApplyReservations counts the GPUs set aside by the active reservations as usage,
+// except the ones of reservationID, and the ones already held by the workloads deployed by the reservations,
+// either committed or provisional, since the provisional ones are already counted as usage by the caller.
+// The reservation of reservationID must belong to tenant.
+func (p Plugin) doApplyReservations(ctx context.Context, nodesResourceInfo map[string]*gputypes.NodeResourceInfo, reservationID string, tenant string) error {
+	reservations, _, err := p.doGetReservations(ctx)
+	if err != nil {
+		return err
+	}
+	if reservationID != "" {
+		reservation, ok := reservations[reservationID]
+		if !ok {
+			return errors.Wrapf(gputypes.ErrReservationNotExists, "reservation: %s", reservationID)
+		}
+		if reservation.Tenant != tenant {
+			return errors.Wrapf(gputypes.ErrInvalidReservation, "reservation %s doesn't belong to tenant %q", reservationID, tenant)
+		}
+	}
+
+	now := time.Now()
+	for nodename, nodeResourceInfo := range nodesResourceInfo {
+		active := []*gputypes.Reservation{}
+		for _, reservation := range reservations {
+			if _, ok := reservation.NodeCountMap[nodename]; ok && reservation.ID != reservationID && reservation.Active(now) {
+				active = append(active, reservation)
+			}
+		}
+		if len(active) == 0 {
+			continue
+		}
+		allocations, err := p.doGetAllocations(ctx, nodename)
+		if err != nil {
+			return err
+		}
+		holdings := []*gputypes.WorkloadResource{}
+		for _, allocation := range allocations {
+			holdings = append(holdings, allocation)
+		}
+		if p.provisionalEnabled() {
+			provisionals, err := p.doGetProvisionals(ctx, fmt.Sprintf(provisionalPrefix, nodename))
+			if err != nil {
+				return err
+			}
+			holdings = append(holdings, provisionals[nodename]...)
+		}
+		held := map[string]int{}
+		for _, holding := range holdings {
+			if reservation, ok := reservations[holding.ReservationID]; ok {
+				held[reservation.ID] += holding.ProdCountMap[reservation.Product]
+			}
+		}
+		for _, reservation := range active {
+			if outstanding := reservation.NodeCountMap[nodename] - held[reservation.ID]; outstanding > 0 {
+				nodeResourceInfo.Usage.ProdCountMap[reservation.Product] += outstanding
+			}
+		}
+	}
+	return nil
+}
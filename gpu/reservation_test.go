@@ -0,0 +1,152 @@
+package gpu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestReservations(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	nodeA := generateNodeWithGPUMap(ctx, t, cm, "test-reservation-a", generateGPUMap("nvidia-3070", 4, 0))
+	nodeB := generateNodeWithGPUMap(ctx, t, cm, "test-reservation-b", generateGPUMap("nvidia-3070", 4, 0))
+	now := time.Now()
+
+	_, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-a", Product: "nvidia-3070", Count: 1, Start: now, End: now.Add(time.Hour)})
+	assert.ErrorIs(t, err, types.ErrInvalidReservation)
+	_, err = cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-a", Product: "nvidia-3070", Nodes: []string{"test-unknown"}, Count: 1, Start: now, End: now.Add(time.Hour)})
+	assert.ErrorIs(t, err, types.ErrUnavailableNodes)
+
+	r1, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-a", Product: "nvidia-3070", Nodes: []string{nodeA}, Count: 3, Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{nodeA: 3}, r1.NodeCountMap)
+	// the GPUs can't be overbooked in the same window, but can be booked in another one
+	_, err = cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-b", Product: "nvidia-3070", Nodes: []string{nodeA}, Count: 2, Start: now, End: now.Add(time.Hour)})
+	assert.ErrorIs(t, err, coretypes.ErrInsufficientResource)
+	r2, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-b", Product: "nvidia-3070", Nodes: []string{nodeA}, Count: 2, Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	assert.Nil(t, err)
+	// the pool is filled from the node with the most spare GPUs
+	r3, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-b", Product: "nvidia-3070", Pool: []string{nodeA, nodeB}, Count: 2, Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{nodeB: 2}, r3.NodeCountMap)
+
+	reservations, err := cm.ListReservations(ctx, "team-b")
+	assert.Nil(t, err)
+	assert.Len(t, reservations, 2)
+	assert.Equal(t, r3.ID, reservations[0].ID)
+	assert.Equal(t, r2.ID, reservations[1].ID)
+	reservations, err = cm.ListReservations(ctx, "")
+	assert.Nil(t, err)
+	assert.Len(t, reservations, 3)
+
+	// the reserved GPUs are only available to the requests of the reservation
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+	}
+	r, err := cm.GetNodesDeployCapacity(ctx, []string{nodeA, nodeB}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.NodeDeployCapacityMap[nodeA].Capacity)
+	assert.Equal(t, 2, r.NodeDeployCapacityMap[nodeB].Capacity)
+	req["reservation_id"] = r1.ID
+	// the reservation can only be used by its tenant
+	_, err = cm.GetNodesDeployCapacity(ctx, []string{nodeA, nodeB}, req)
+	assert.ErrorIs(t, err, types.ErrInvalidReservation)
+	req["tenant"] = "team-b"
+	_, err = cm.CalculateDeploy(ctx, nodeA, 1, req)
+	assert.ErrorIs(t, err, types.ErrInvalidReservation)
+	req["tenant"] = "team-a"
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{nodeA, nodeB}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, r.NodeDeployCapacityMap[nodeA].Capacity)
+	assert.Equal(t, 2, r.NodeDeployCapacityMap[nodeB].Capacity)
+
+	d, err := cm.CalculateDeploy(ctx, nodeA, 3, req)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+	assert.Equal(t, r1.ID, wr.ReservationID)
+	delete(req, "reservation_id")
+	delete(req, "tenant")
+	_, err = cm.CalculateDeploy(ctx, nodeA, 2, req)
+	assert.True(t, errors.Is(err, coretypes.ErrInsufficientResource))
+
+	// the GPUs held by the workloads of reservation are not counted twice
+	_, err = cm.SetNodeResourceUsage(ctx, nodeA, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{nodeA}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Total)
+
+	req["reservation_id"] = "unknown"
+	_, err = cm.CalculateDeploy(ctx, nodeA, 1, req)
+	assert.ErrorIs(t, err, types.ErrReservationNotExists)
+
+	// the workloads are reallocated without the reservation once it's deleted
+	assert.Nil(t, cm.DeleteReservation(ctx, r1.ID))
+	rr, err := cm.CalculateRealloc(ctx, nodeA, d.WorkloadsResource[0], plugintypes.WorkloadResourceRequest{})
+	assert.Nil(t, err)
+	assert.Nil(t, wr.Parse(rr.WorkloadResource))
+	assert.Equal(t, "", wr.ReservationID)
+
+	assert.Nil(t, cm.DeleteReservation(ctx, r3.ID))
+	assert.ErrorIs(t, cm.DeleteReservation(ctx, r3.ID), types.ErrReservationNotExists)
+	delete(req, "reservation_id")
+	r, err = cm.GetNodesDeployCapacity(ctx, []string{nodeB}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, r.Total)
+
+	// the expired reservations are hidden and pruned by the next update
+	r4, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-c", Product: "nvidia-3070", Nodes: []string{nodeB}, Count: 1, Start: now.Add(-time.Minute), End: time.Now().Add(100 * time.Millisecond)})
+	assert.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	reservations, err = cm.ListReservations(ctx, "team-c")
+	assert.Nil(t, err)
+	assert.Empty(t, reservations)
+	assert.Nil(t, cm.DeleteReservation(ctx, r2.ID))
+	kv, err := cm.store.Get(ctx, reservationsKey)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(kv.Value), r4.ID)
+}
+
+func TestReservationsWithProvisionals(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPUWithConfig(ctx, t, &types.Config{Provisional: types.ProvisionalConfig{TTL: time.Minute}})
+	node := generateNodeWithGPUMap(ctx, t, cm, "test-reservation-provisional", generateGPUMap("nvidia-3070", 4, 0))
+	now := time.Now()
+	reservation, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-a", Product: "nvidia-3070", Nodes: []string{node}, Count: 3, Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	assert.Nil(t, err)
+	t.Cleanup(func() { assert.Nil(t, cm.DeleteReservation(ctx, reservation.ID)) })
+
+	req := plugintypes.WorkloadResourceRequest{
+		"prod_count_map": types.ProdCountMap{"nvidia-3070": 1},
+		"tenant":         "team-a",
+		"reservation_id": reservation.ID,
+	}
+	d, err := cm.CalculateDeploy(ctx, node, 2, req)
+	assert.Nil(t, err)
+	capacityOf := func(req plugintypes.WorkloadResourceRequest) int {
+		r, err := cm.GetNodesDeployCapacity(ctx, []string{node}, req)
+		assert.Nil(t, err)
+		return r.Total
+	}
+
+	// the deployment in progress is held by the reservation, so it's not counted twice
+	others := plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}}
+	assert.Equal(t, 1, capacityOf(others))
+	assert.Equal(t, 2, capacityOf(req))
+
+	// and the same once it's committed
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, capacityOf(others))
+	assert.Equal(t, 2, capacityOf(req))
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, d.WorkloadsResource, true, false)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,176 @@
+package gpu
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/projecteru2/core/log"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// ExportSnapshot returns the resource info and the records of allocations of all nodes, with their labels,
+// the reservations and the quotas. The corrupt nodes are left out and reported in the snapshot.
+func (p Plugin) ExportSnapshot(ctx context.Context) (*gputypes.Snapshot, error) {
+	nodenames, err := p.doListNodenames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodesResourceInfo, diagnostics, err := p.doGetNodesResourceInfo(ctx, nodenames)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &gputypes.Snapshot{
+		Version:     gputypes.SnapshotVersion,
+		Time:        time.Now(),
+		Nodes:       nodesResourceInfo,
+		Allocations: map[string][]*gputypes.WorkloadResource{},
+		Corrupt:     []*gputypes.NodeDiagnostic{},
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Problem == gputypes.DiagnosticCorrupt {
+			snapshot.Corrupt = append(snapshot.Corrupt, diagnostic)
+		}
+	}
+
+	exported := []string{}
+	for nodename := range nodesResourceInfo {
+		exported = append(exported, nodename)
+		allocations, err := p.doGetAllocations(ctx, nodename)
+		if err != nil {
+			return nil, err
+		}
+		allocIDs := []string{}
+		for allocID := range allocations {
+			allocIDs = append(allocIDs, allocID)
+		}
+		sort.Strings(allocIDs)
+		for _, allocID := range allocIDs {
+			snapshot.Allocations[nodename] = append(snapshot.Allocations[nodename], allocations[allocID])
+		}
+	}
+	if snapshot.Labels, err = p.doGetNodesLabels(ctx, exported); err != nil {
+		return nil, err
+	}
+	if snapshot.Reservations, _, err = p.doGetReservations(ctx); err != nil {
+		return nil, err
+	}
+	if snapshot.Quotas, _, err = p.doGetQuotas(ctx); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ImportSnapshot restores the resource info of nodes from snapshot, all the nodes are validated before anything is written.
+// The records of allocations and the labels of the nodes imported are replaced by the ones in snapshot, so they match the usage.
+// The nodes, reservations and quotas not in snapshot are kept by merge, and removed by replace.
+// The snapshot of version 1 only has the nodes, the labels, reservations and quotas are kept as they are.
+// Nodes are written one by one, if a write fails, the nodes already written are returned with the error.
+func (p Plugin) ImportSnapshot(ctx context.Context, snapshot *gputypes.Snapshot, mode string) (*gputypes.ImportResult, error) {
+	switch mode {
+	case gputypes.ImportValidate, gputypes.ImportMerge, gputypes.ImportReplace:
+	default:
+		return nil, errors.Wrapf(gputypes.ErrInvalidSnapshot, "unknown import mode %s", mode)
+	}
+	if err := snapshot.Validate(); err != nil {
+		return nil, err
+	}
+	nodenames := []string{}
+	for nodename, nodeResourceInfo := range snapshot.Nodes {
+		if err := p.checkProds(nodeResourceInfo.Capacity); err != nil {
+			return nil, errors.Wrapf(err, "node %s", nodename)
+		}
+		nodenames = append(nodenames, nodename)
+	}
+	sort.Strings(nodenames)
+
+	removed := []string{}
+	if mode == gputypes.ImportReplace {
+		// the corrupt nodes are removed as well
+		current, err := p.doListNodenames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, nodename := range current {
+			if _, ok := snapshot.Nodes[nodename]; !ok {
+				removed = append(removed, nodename)
+			}
+		}
+		sort.Strings(removed)
+	}
+
+	resp := &gputypes.ImportResult{Imported: nodenames, Removed: removed}
+	if mode == gputypes.ImportValidate {
+		return resp, nil
+	}
+
+	logger := log.WithFunc("resource.gpu.ImportSnapshot")
+	written := &gputypes.ImportResult{Imported: []string{}, Removed: []string{}}
+	for _, nodename := range nodenames {
+		// the resource info is validated again here
+		if err := p.doImportNode(ctx, nodename, snapshot.Nodes[nodename].DeepCopy(), snapshot.Allocations[nodename]); err != nil {
+			logger.WithField("node", nodename).Error(ctx, err, "failed to import node")
+			return written, errors.Wrapf(err, "node %s, imported: %v", nodename, written.Imported)
+		}
+		if snapshot.Version >= 2 {
+			if err := p.doSetNodeLabels(ctx, nodename, snapshot.Labels[nodename]); err != nil {
+				logger.WithField("node", nodename).Error(ctx, err, "failed to import labels")
+				return written, errors.Wrapf(err, "labels of node %s, imported: %v", nodename, written.Imported)
+			}
+		}
+		written.Imported = append(written.Imported, nodename)
+	}
+	for _, nodename := range removed {
+		if _, err := p.RemoveNode(ctx, nodename); err != nil {
+			return written, errors.Wrapf(err, "node %s, imported: %v, removed: %v", nodename, written.Imported, written.Removed)
+		}
+		written.Removed = append(written.Removed, nodename)
+	}
+	if snapshot.Version < 2 {
+		return resp, nil
+	}
+	if err := p.updateQuotas(ctx, func(quotas map[string]gputypes.ProdCountMap) error {
+		if mode == gputypes.ImportReplace {
+			for tenant := range quotas {
+				delete(quotas, tenant)
+			}
+		}
+		for tenant, limit := range snapshot.Quotas {
+			quotas[tenant] = limit.DeepCopy()
+		}
+		return nil
+	}); err != nil {
+		return written, errors.Wrapf(err, "quotas, imported: %v, removed: %v", written.Imported, written.Removed)
+	}
+	if err := p.updateReservations(ctx, func(reservations map[string]*gputypes.Reservation) error {
+		if mode == gputypes.ImportReplace {
+			for id := range reservations {
+				delete(reservations, id)
+			}
+		}
+		for id, reservation := range snapshot.Reservations {
+			reservations[id] = reservation
+		}
+		return nil
+	}); err != nil {
+		return written, errors.Wrapf(err, "reservations, imported: %v, removed: %v", written.Imported, written.Removed)
+	}
+	return resp, nil
+}
+
+// doImportNode writes the resource info of node and replaces its records with the allocations
+func (p Plugin) doImportNode(ctx context.Context, nodename string, nodeResourceInfo *gputypes.NodeResourceInfo, allocations []*gputypes.WorkloadResource) error {
+	if err := p.doSetNodeResourceInfo(ctx, nodename, nodeResourceInfo); err != nil {
+		return err
+	}
+	if err := p.doRemoveAllocations(ctx, nodename); err != nil {
+		return err
+	}
+	for _, allocation := range allocations {
+		if err := p.doReplaceAllocation(ctx, nodename, allocation.AllocID, allocation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
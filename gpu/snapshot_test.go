@@ -0,0 +1,219 @@
+package gpu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	nodes := generateNodes(ctx, t, cm, 2, 0)
+	_, err := cm.SetNodeResourceUsage(ctx, nodes[0], nil, nil, []plugintypes.WorkloadResource{
+		{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}},
+	}, true, true)
+	assert.Nil(t, err)
+
+	snapshot, err := cm.ExportSnapshot(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, types.SnapshotVersion, snapshot.Version)
+	assert.Len(t, snapshot.Nodes, 2)
+	assert.Equal(t, 1, snapshot.Nodes[nodes[0]].UsageCount())
+
+	// the snapshot is kept through JSON
+	data, err := json.Marshal(snapshot)
+	assert.Nil(t, err)
+	snapshot = &types.Snapshot{}
+	assert.Nil(t, json.Unmarshal(data, snapshot))
+
+	// import into another storage
+	func() {
+		cm, err := NewPlugin(ctx, coretypes.Config{}, &types.Config{Storage: types.StorageConfig{Type: types.StorageMemory}})
+		assert.Nil(t, err)
+		others := generateNodes(ctx, t, cm, 1, 2)
+
+		// nothing is written by validate
+		r, err := cm.ImportSnapshot(ctx, snapshot, types.ImportValidate)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, nodes, r.Imported)
+		assert.Len(t, r.Removed, 0)
+		_, err = cm.GetNodeResourceInfo(ctx, nodes[0], nil)
+		assert.Error(t, err)
+
+		// the other nodes are kept by merge
+		_, err = cm.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+		assert.Nil(t, err)
+		imported, err := cm.ExportSnapshot(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, imported.Nodes, 3)
+		assert.Equal(t, 1, imported.Nodes[nodes[0]].UsageCount())
+
+		// and removed by replace
+		r, err = cm.ImportSnapshot(ctx, snapshot, types.ImportReplace)
+		assert.Nil(t, err)
+		assert.Equal(t, others, r.Removed)
+		imported, err = cm.ExportSnapshot(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, imported.Nodes, 2)
+		// the removed node is added back for cleanup
+		_, err = cm.AddNode(ctx, others[0], generateNodeResourceRequests(t, 1, 2, "test", 8)[others[0]], nil)
+		assert.Nil(t, err)
+	}()
+
+	// nothing is written if any node is invalid
+	snapshot.Nodes["test-x"] = &types.NodeResourceInfo{
+		Capacity: &types.NodeResource{ProdCountMap: types.ProdCountMap{"nvidia-3070": 1}},
+		Usage:    &types.NodeResource{AddrCountMap: types.AddrCountMap{"0000:ff:00.0": 1}},
+	}
+	snapshot.Nodes[nodes[0]].Usage.ProdCountMap = types.ProdCountMap{}
+	_, err = cm.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+	assert.Error(t, err)
+	info, err := cm.doGetNodeResourceInfo(ctx, nodes[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, info.UsageCount())
+
+	delete(snapshot.Nodes, "test-x")
+	_, err = cm.ImportSnapshot(ctx, snapshot, "overwrite")
+	assert.ErrorIs(t, err, types.ErrInvalidSnapshot)
+	snapshot.Version = types.SnapshotVersion + 1
+	_, err = cm.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+	assert.ErrorIs(t, err, types.ErrInvalidSnapshot)
+}
+
+// failingStore fails the puts of key
+type failingStore struct {
+	store.Store
+	key string
+}
+
+func (s failingStore) Put(ctx context.Context, key, value string) error {
+	if key == s.key {
+		return errors.New("put failed")
+	}
+	return s.Store.Put(ctx, key, value)
+}
+
+func TestSnapshotAllocations(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node1 := generateNodeWithGPUMap(ctx, t, cm, "test-snapshot-1", generateGPUMap("nvidia-3070", 4, 0))
+	node2 := generateNodeWithGPUMap(ctx, t, cm, "test-snapshot-2", generateGPUMap("nvidia-3070", 4, 0))
+	d, err := cm.CalculateDeploy(ctx, node1, 1, plugintypes.WorkloadResourceRequest{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}})
+	assert.Nil(t, err)
+	_, err = cm.SetNodeResourceUsage(ctx, node1, nil, nil, d.WorkloadsResource, true, true)
+	assert.Nil(t, err)
+	wr := &types.WorkloadResource{}
+	assert.Nil(t, wr.Parse(d.WorkloadsResource[0]))
+
+	snapshot, err := cm.ExportSnapshot(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, snapshot.Allocations[node1], 1)
+	assert.Equal(t, wr.AllocID, snapshot.Allocations[node1][0].AllocID)
+	assert.Len(t, snapshot.Allocations[node2], 0)
+
+	// the records are restored with the usage
+	assert.Nil(t, cm.store.Delete(ctx, fmt.Sprintf(allocationKey, node1, wr.AllocID)))
+	_, err = cm.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+	assert.Nil(t, err)
+	allocations, err := cm.doGetAllocations(ctx, node1)
+	assert.Nil(t, err)
+	assert.Contains(t, allocations, wr.AllocID)
+
+	// the snapshot of version 1 has no records, so the records of nodes imported are cleared
+	_, err = cm.ImportSnapshot(ctx, &types.Snapshot{Version: 1, Nodes: snapshot.Nodes}, types.ImportMerge)
+	assert.Nil(t, err)
+	allocations, err = cm.doGetAllocations(ctx, node1)
+	assert.Nil(t, err)
+	assert.Len(t, allocations, 0)
+
+	// the allocations of nodes not in snapshot are invalid
+	snapshot.Allocations["test-x"] = snapshot.Allocations[node1]
+	_, err = cm.ImportSnapshot(ctx, snapshot, types.ImportValidate)
+	assert.ErrorIs(t, err, types.ErrInvalidSnapshot)
+	delete(snapshot.Allocations, "test-x")
+
+	// the nodes written before the failure are reported
+	origin := cm.store
+	cm.store = failingStore{Store: origin, key: fmt.Sprintf(nodeResourceInfoKey, node2)}
+	r, err := cm.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+	cm.store = origin
+	assert.Error(t, err)
+	assert.Equal(t, []string{node1}, r.Imported)
+	assert.Contains(t, err.Error(), node1)
+}
+
+func TestSnapshotLabelsReservationsQuotas(t *testing.T) {
+	ctx := context.Background()
+	cm := initGPU(ctx, t)
+	node1 := generateNodeWithGPUMap(ctx, t, cm, "test-snapshot-1", generateGPUMap("nvidia-3070", 4, 0))
+	node2 := generateNodeWithGPUMap(ctx, t, cm, "test-snapshot-2", generateGPUMap("nvidia-3070", 4, 0))
+	assert.Nil(t, cm.SetNodeLabels(ctx, node1, types.NodeLabels{"rack": "r1"}))
+	assert.Nil(t, cm.SetQuota(ctx, "team-a", types.ProdCountMap{"nvidia-3070": 4}))
+	now := time.Now()
+	reservation, err := cm.CreateReservation(ctx, &types.ReservationRequest{Tenant: "team-a", Product: "nvidia-3070", Nodes: []string{node1}, Count: 1, Start: now, End: now.Add(time.Hour)})
+	assert.Nil(t, err)
+	// the corrupt node is left out and reported
+	assert.Nil(t, cm.store.Put(ctx, fmt.Sprintf(nodeResourceInfoKey, "test-corrupt"), "{"))
+
+	snapshot, err := cm.ExportSnapshot(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, snapshot.Nodes, 2)
+	assert.Len(t, snapshot.Corrupt, 1)
+	assert.Equal(t, "test-corrupt", snapshot.Corrupt[0].Nodename)
+	assert.Equal(t, map[string]types.NodeLabels{node1: {"rack": "r1"}}, snapshot.Labels)
+	assert.Contains(t, snapshot.Reservations, reservation.ID)
+	assert.Equal(t, map[string]types.ProdCountMap{"team-a": {"nvidia-3070": 4}}, snapshot.Quotas)
+	data, err := json.Marshal(snapshot)
+	assert.Nil(t, err)
+	snapshot = &types.Snapshot{}
+	assert.Nil(t, json.Unmarshal(data, snapshot))
+
+	cm2, err := NewPlugin(ctx, coretypes.Config{}, &types.Config{Storage: types.StorageConfig{Type: types.StorageMemory}})
+	assert.Nil(t, err)
+	assert.Nil(t, cm2.SetQuota(ctx, "team-b", types.ProdCountMap{"nvidia-3070": 1}))
+	assert.Nil(t, cm2.store.Put(ctx, fmt.Sprintf(nodeResourceInfoKey, "test-corrupt"), "{"))
+
+	// the quotas not in snapshot are kept by merge
+	_, err = cm2.ImportSnapshot(ctx, snapshot, types.ImportMerge)
+	assert.Nil(t, err)
+	labels, err := cm2.GetNodeLabels(ctx, node1)
+	assert.Nil(t, err)
+	assert.Equal(t, types.NodeLabels{"rack": "r1"}, labels)
+	reservations, err := cm2.ListReservations(ctx, "team-a")
+	assert.Nil(t, err)
+	assert.Len(t, reservations, 1)
+	quotas, err := cm2.ListQuotas(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, quotas, 2)
+
+	// and removed by replace, so are the corrupt nodes
+	delete(snapshot.Labels, node1)
+	r, err := cm2.ImportSnapshot(ctx, snapshot, types.ImportReplace)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test-corrupt"}, r.Removed)
+	labels, err = cm2.GetNodeLabels(ctx, node1)
+	assert.Nil(t, err)
+	assert.Len(t, labels, 0)
+	quotas, err = cm2.ListQuotas(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, quotas, 1)
+	assert.Equal(t, "team-a", quotas[0].Tenant)
+	nodenames, err := cm2.doListNodenames(ctx)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{node1, node2}, nodenames)
+
+	// the labels of nodes not in snapshot are invalid
+	snapshot.Labels = map[string]types.NodeLabels{"test-x": {"rack": "r1"}}
+	_, err = cm2.ImportSnapshot(ctx, snapshot, types.ImportValidate)
+	assert.ErrorIs(t, err, types.ErrInvalidSnapshot)
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"math"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	coretypes "github.com/projecteru2/core/types"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+// ETCD stores the keys in etcd under the prefix of config
+type ETCD struct {
+	cli     *clientv3.Client
+	kv      clientv3.KV
+	watcher clientv3.Watcher
+	lease   clientv3.Lease
+}
+
+// NewETCD creates the etcd client in the same way as meta.NewETCD
+func NewETCD(config coretypes.EtcdConfig) (*ETCD, error) {
+	if len(config.Machines) < 1 {
+		return nil, coretypes.ErrConfigInvaild
+	}
+	var tlsConfig *tls.Config
+	if config.Ca != "" && config.Key != "" && config.Cert != "" {
+		tlsInfo := transport.TLSInfo{
+			TrustedCAFile: config.Ca,
+			KeyFile:       config.Key,
+			CertFile:      config.Cert,
+		}
+		var err error
+		if tlsConfig, err = tlsInfo.ClientConfig(); err != nil {
+			return nil, err
+		}
+	}
+	cliv3, err := clientv3.New(clientv3.Config{
+		Endpoints: config.Machines,
+		Username:  config.Auth.Username,
+		Password:  config.Auth.Password,
+		TLS:       tlsConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ETCD{
+		cli:     cliv3,
+		kv:      namespace.NewKV(cliv3.KV, config.Prefix),
+		watcher: namespace.NewWatcher(cliv3.Watcher, config.Prefix),
+		lease:   cliv3.Lease,
+	}, nil
+}
+
+// NewETCDWithClient uses the client given, which is namespaced by the caller and not closed by Close,
+// e.g. the client of an embedded cluster in tests
+func NewETCDWithClient(cliv3 *clientv3.Client) *ETCD {
+	return &ETCD{kv: cliv3, watcher: cliv3, lease: cliv3}
+}
+
+// Get .
+func (e *ETCD) Get(ctx context.Context, key string) (*KeyValue, error) {
+	resp, err := e.kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count != 1 {
+		return nil, ErrKeyNotExists
+	}
+	kv := resp.Kvs[0]
+	return &KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision}, nil
+}
+
+// GetMulti .
+func (e *ETCD) GetMulti(ctx context.Context, keys []string) ([]*KeyValue, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	ops := []clientv3.Op{}
+	for _, key := range keys {
+		ops = append(ops, clientv3.OpGet(key))
+	}
+	resp, err := e.kv.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	kvs := []*KeyValue{}
+	for _, r := range resp.Responses {
+		for _, kv := range r.GetResponseRange().Kvs {
+			kvs = append(kvs, &KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision})
+		}
+	}
+	return kvs, nil
+}
+
+// GetPrefix .
+func (e *ETCD) GetPrefix(ctx context.Context, prefix string) ([]*KeyValue, error) {
+	resp, err := e.kv.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	kvs := []*KeyValue{}
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, &KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision})
+	}
+	return kvs, nil
+}
+
+// Put .
+func (e *ETCD) Put(ctx context.Context, key, value string) error {
+	_, err := e.kv.Put(ctx, key, value)
+	return err
+}
+
+// PutWithTTL attaches the key to a lease, the TTL of lease is in seconds, so ttl is rounded up
+func (e *ETCD) PutWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	lease, err := e.lease.Grant(ctx, int64(math.Ceil(ttl.Seconds())))
+	if err != nil {
+		return err
+	}
+	_, err = e.kv.Put(ctx, key, value, clientv3.WithLease(lease.ID))
+	return err
+}
+
+// Delete .
+func (e *ETCD) Delete(ctx context.Context, key string) error {
+	_, err := e.kv.Delete(ctx, key)
+	return err
+}
+
+// CompareAndSwap compares the mod revision of key
+func (e *ETCD) CompareAndSwap(ctx context.Context, key, value string, revision int64) (bool, error) {
+	resp, err := e.kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+		Then(clientv3.OpPut(key, value)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// CompareAndDelete compares the mod revision of key
+func (e *ETCD) CompareAndDelete(ctx context.Context, key string, revision int64) (bool, error) {
+	resp, err := e.kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// Watch .
+func (e *ETCD) Watch(ctx context.Context, prefix string) <-chan *Event {
+	ch := make(chan *Event)
+	wch := e.watcher.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithCreatedNotify())
+	// wait until the watch is created, so the changes made after Watch returns won't be missed
+	if resp, ok := <-wch; !ok || resp.Err() != nil {
+		if ok {
+			log.WithFunc("store.ETCD.Watch").Error(ctx, resp.Err())
+		}
+		close(ch)
+		return ch
+	}
+	go func() {
+		defer close(ch)
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				log.WithFunc("store.ETCD.Watch").Error(ctx, err)
+				return
+			}
+			for _, ev := range resp.Events {
+				event := &Event{Type: EventPut, Key: string(ev.Kv.Key), Value: ev.Kv.Value}
+				if ev.Type == mvccpb.DELETE {
+					event.Type = EventDelete
+					event.Value = nil
+				}
+				if ev.PrevKv != nil {
+					event.PrevValue = ev.PrevKv.Value
+				}
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// Close closes the client, the embedded cluster is closed by the test
+func (e *ETCD) Close() error {
+	if e.cli == nil {
+		return nil
+	}
+	return e.cli.Close()
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("gpu")
+
+const (
+	// revisionSize is the size of the revision stored in front of every value
+	revisionSize = 8
+	// deadlineSize is the size of the deadline stored after the revision, in unix nano, 0 means never expire
+	deadlineSize = 8
+	// openTimeout is how long to wait for the other processes to release the file
+	openTimeout = 10 * time.Second
+	// anyRevision deletes the key at any revision
+	anyRevision = -1
+)
+
+// File keeps the keys in a single bbolt file, so the state is kept across invocations of the binary plugin,
+// the file is locked while opened, so only one process can use it at a time.
+type File struct {
+	db *bolt.DB
+	// mutex keeps the order of events the same as the order of writes
+	mutex    sync.Mutex
+	notifier notifier
+}
+
+// NewFile opens the file, it's created if not exists
+func NewFile(path string) (*File, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &File{db: db}, nil
+}
+
+// Get .
+func (f *File) Get(_ context.Context, key string) (*KeyValue, error) {
+	kvs, err := f.read(func(b *bolt.Bucket, visit func(string)) {
+		visit(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(kvs) == 0 {
+		return nil, ErrKeyNotExists
+	}
+	return kvs[0], nil
+}
+
+// GetMulti .
+func (f *File) GetMulti(_ context.Context, keys []string) ([]*KeyValue, error) {
+	return f.read(func(b *bolt.Bucket, visit func(string)) {
+		for _, key := range keys {
+			visit(key)
+		}
+	})
+}
+
+// GetPrefix .
+func (f *File) GetPrefix(_ context.Context, prefix string) ([]*KeyValue, error) {
+	return f.read(func(b *bolt.Bucket, visit func(string)) {
+		c := b.Cursor()
+		// the keys are sorted in bbolt
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			visit(string(k))
+		}
+	})
+}
+
+// read returns the keys visited which are not expired, the expired ones are swept afterwards
+func (f *File) read(scan func(b *bolt.Bucket, visit func(string))) ([]*KeyValue, error) {
+	kvs := []*KeyValue{}
+	expired := []*KeyValue{}
+	now := time.Now()
+	if err := f.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		scan(b, func(key string) {
+			kv, deadline := f.lookup(b, key)
+			switch {
+			case kv == nil:
+			case expiredAt(deadline, now):
+				expired = append(expired, kv)
+			default:
+				kvs = append(kvs, kv)
+			}
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	f.sweep(expired)
+	return kvs, nil
+}
+
+// sweep deletes the expired keys unless they are put again since read,
+// it's fine to fail since they are treated as missing anyway.
+func (f *File) sweep(expired []*KeyValue) {
+	if len(expired) == 0 {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	events := []*Event{}
+	if err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for _, e := range expired {
+			if kv, _ := f.lookup(b, e.Key); kv == nil || kv.Revision != e.Revision {
+				continue
+			}
+			if err := b.Delete([]byte(e.Key)); err != nil {
+				return err
+			}
+			events = append(events, &Event{Type: EventDelete, Key: e.Key, PrevValue: e.Value})
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	for _, event := range events {
+		f.notifier.notify(event)
+	}
+}
+
+// Put .
+func (f *File) Put(_ context.Context, key, value string) error {
+	return f.putWithDeadline(key, value, time.Time{})
+}
+
+// PutWithTTL keeps the deadline with the value, the key is treated as missing after that unless it's modified again,
+// so it expires across restarts too. The expired keys are swept lazily when they are read.
+func (f *File) PutWithTTL(_ context.Context, key, value string, ttl time.Duration) error {
+	return f.putWithDeadline(key, value, time.Now().Add(ttl))
+}
+
+func (f *File) putWithDeadline(key, value string, deadline time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var event *Event
+	if err := f.db.Update(func(tx *bolt.Tx) (err error) {
+		event, err = f.put(tx.Bucket(bucket), key, value, deadline)
+		return err
+	}); err != nil {
+		return err
+	}
+	f.notifier.notify(event)
+	return nil
+}
+
+// Delete .
+func (f *File) Delete(_ context.Context, key string) error {
+	_, err := f.deleteAt(key, anyRevision)
+	return err
+}
+
+// CompareAndDelete .
+func (f *File) CompareAndDelete(_ context.Context, key string, revision int64) (bool, error) {
+	return f.deleteAt(key, revision)
+}
+
+// deleteAt deletes the key only if it's still at revision, 0 means the key doesn't exist
+func (f *File) deleteAt(key string, revision int64) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var event *Event
+	ok := false
+	if err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		// the expired key is treated as missing, but it's deleted as well
+		kv, deadline := f.lookup(b, key)
+		var current int64
+		if kv != nil && !expiredAt(deadline, time.Now()) {
+			current = kv.Revision
+		}
+		if revision != anyRevision && current != revision {
+			return nil
+		}
+		ok = true
+		if kv == nil {
+			return nil
+		}
+		event = &Event{Type: EventDelete, Key: key, PrevValue: kv.Value}
+		return b.Delete([]byte(key))
+	}); err != nil {
+		return false, err
+	}
+	if event != nil {
+		f.notifier.notify(event)
+	}
+	return ok, nil
+}
+
+// CompareAndSwap .
+func (f *File) CompareAndSwap(_ context.Context, key, value string, revision int64) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var event *Event
+	if err := f.db.Update(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket(bucket)
+		var current int64
+		if kv := f.get(b, key); kv != nil {
+			current = kv.Revision
+		}
+		if current != revision {
+			return nil
+		}
+		event, err = f.put(b, key, value, time.Time{})
+		return err
+	}); err != nil {
+		return false, err
+	}
+	if event == nil {
+		return false, nil
+	}
+	f.notifier.notify(event)
+	return true, nil
+}
+
+// Watch only sends the changes made by this process, no other process can open the file at the same time
+func (f *File) Watch(ctx context.Context, prefix string) <-chan *Event {
+	return f.notifier.watch(ctx, prefix)
+}
+
+// Close releases the file
+func (f *File) Close() error {
+	return f.db.Close()
+}
+
+// get returns nil if the key is missing or expired
+func (f *File) get(b *bolt.Bucket, key string) *KeyValue {
+	kv, deadline := f.lookup(b, key)
+	if expiredAt(deadline, time.Now()) {
+		return nil
+	}
+	return kv
+}
+
+// lookup returns the key even if it's expired, with its deadline
+func (f *File) lookup(b *bolt.Bucket, key string) (*KeyValue, int64) {
+	data := b.Get([]byte(key))
+	if len(data) < revisionSize+deadlineSize {
+		return nil, 0
+	}
+	// the data is only valid in the transaction
+	return &KeyValue{
+		Key:      key,
+		Value:    append([]byte{}, data[revisionSize+deadlineSize:]...),
+		Revision: int64(binary.BigEndian.Uint64(data[:revisionSize])),
+	}, int64(binary.BigEndian.Uint64(data[revisionSize : revisionSize+deadlineSize]))
+}
+
+func (f *File) put(b *bolt.Bucket, key, value string, deadline time.Time) (*Event, error) {
+	event := &Event{Type: EventPut, Key: key, Value: []byte(value)}
+	if kv := f.get(b, key); kv != nil {
+		event.PrevValue = kv.Value
+	}
+	revision, err := b.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, revisionSize+deadlineSize+len(value))
+	binary.BigEndian.PutUint64(data, revision)
+	if !deadline.IsZero() {
+		binary.BigEndian.PutUint64(data[revisionSize:], uint64(deadline.UnixNano()))
+	}
+	copy(data[revisionSize+deadlineSize:], value)
+	return event, b.Put([]byte(key), data)
+}
+
+// expiredAt returns true if the deadline in unix nano is passed at now, 0 means never
+func expiredAt(deadline int64, now time.Time) bool {
+	return deadline != 0 && now.UnixNano() >= deadline
+}
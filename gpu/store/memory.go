@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps the keys in memory, they are lost when the process exits
+type Memory struct {
+	sync.Mutex
+	kvs map[string]*KeyValue
+	// deadlines are the deadlines of the keys put with ttl
+	deadlines map[string]time.Time
+	revision  int64
+	notifier  notifier
+}
+
+// NewMemory .
+func NewMemory() *Memory {
+	return &Memory{kvs: map[string]*KeyValue{}, deadlines: map[string]time.Time{}}
+}
+
+// Get .
+func (m *Memory) Get(_ context.Context, key string) (*KeyValue, error) {
+	m.Lock()
+	defer m.Unlock()
+	kv, ok := m.get(key)
+	if !ok {
+		return nil, ErrKeyNotExists
+	}
+	return m.copy(kv), nil
+}
+
+// GetMulti .
+func (m *Memory) GetMulti(_ context.Context, keys []string) ([]*KeyValue, error) {
+	m.Lock()
+	defer m.Unlock()
+	kvs := []*KeyValue{}
+	for _, key := range keys {
+		if kv, ok := m.get(key); ok {
+			kvs = append(kvs, m.copy(kv))
+		}
+	}
+	return kvs, nil
+}
+
+// GetPrefix .
+func (m *Memory) GetPrefix(_ context.Context, prefix string) ([]*KeyValue, error) {
+	m.Lock()
+	defer m.Unlock()
+	kvs := []*KeyValue{}
+	for key := range m.kvs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if kv, ok := m.get(key); ok {
+			kvs = append(kvs, m.copy(kv))
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+// Put .
+func (m *Memory) Put(_ context.Context, key, value string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.put(key, value)
+	return nil
+}
+
+// PutWithTTL keeps the deadline with the key, the key is treated as missing after that unless it's modified again,
+// the expired keys are swept lazily when they are accessed.
+func (m *Memory) PutWithTTL(_ context.Context, key, value string, ttl time.Duration) error {
+	m.Lock()
+	defer m.Unlock()
+	m.put(key, value)
+	m.deadlines[key] = time.Now().Add(ttl)
+	return nil
+}
+
+// Delete .
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.get(key); ok {
+		m.delete(key)
+	}
+	return nil
+}
+
+// CompareAndSwap .
+func (m *Memory) CompareAndSwap(_ context.Context, key, value string, revision int64) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	var current int64
+	if kv, ok := m.get(key); ok {
+		current = kv.Revision
+	}
+	if current != revision {
+		return false, nil
+	}
+	m.put(key, value)
+	return true, nil
+}
+
+// CompareAndDelete .
+func (m *Memory) CompareAndDelete(_ context.Context, key string, revision int64) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	kv, ok := m.get(key)
+	if !ok {
+		return revision == 0, nil
+	}
+	if kv.Revision != revision {
+		return false, nil
+	}
+	m.delete(key)
+	return true, nil
+}
+
+// Watch .
+func (m *Memory) Watch(ctx context.Context, prefix string) <-chan *Event {
+	return m.notifier.watch(ctx, prefix)
+}
+
+// Close .
+func (m *Memory) Close() error {
+	return nil
+}
+
+// get returns false if the key is missing or expired, the expired key is swept
+func (m *Memory) get(key string) (*KeyValue, bool) {
+	kv, ok := m.kvs[key]
+	if !ok {
+		return nil, false
+	}
+	if deadline, ok := m.deadlines[key]; ok && !time.Now().Before(deadline) {
+		m.delete(key)
+		return nil, false
+	}
+	return kv, true
+}
+
+func (m *Memory) put(key, value string) {
+	event := &Event{Type: EventPut, Key: key, Value: []byte(value)}
+	if kv, ok := m.get(key); ok {
+		event.PrevValue = kv.Value
+	}
+	m.revision++
+	m.kvs[key] = &KeyValue{Key: key, Value: []byte(value), Revision: m.revision}
+	delete(m.deadlines, key)
+	m.notifier.notify(event)
+}
+
+func (m *Memory) delete(key string) {
+	kv := m.kvs[key]
+	delete(m.kvs, key)
+	delete(m.deadlines, key)
+	m.notifier.notify(&Event{Type: EventDelete, Key: key, PrevValue: kv.Value})
+}
+
+func (m *Memory) copy(kv *KeyValue) *KeyValue {
+	return &KeyValue{Key: kv.Key, Value: append([]byte{}, kv.Value...), Revision: kv.Revision}
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// watchBufferSize is the size of the channel of each watcher
+const watchBufferSize = 128
+
+type watcher struct {
+	prefix string
+	ch     chan *Event
+	// done is closed when the watcher is dropped
+	done chan struct{}
+}
+
+// notifier sends the changes made in this process to the watchers,
+// it's used by the stores which can only be opened by one process.
+// notify is called with the lock of store held, so it never blocks:
+// a watcher whose buffer is full is dropped and its channel is closed, like a failed watch.
+type notifier struct {
+	sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+func (n *notifier) watch(ctx context.Context, prefix string) <-chan *Event {
+	w := &watcher{prefix: prefix, ch: make(chan *Event, watchBufferSize), done: make(chan struct{})}
+	n.Lock()
+	if n.watchers == nil {
+		n.watchers = map[*watcher]struct{}{}
+	}
+	n.watchers[w] = struct{}{}
+	n.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+			return
+		}
+		n.Lock()
+		defer n.Unlock()
+		n.drop(w)
+	}()
+	return w.ch
+}
+
+// notify sends the event to the watchers without blocking, the lagging watchers are dropped
+func (n *notifier) notify(event *Event) {
+	n.Lock()
+	defer n.Unlock()
+	for w := range n.watchers {
+		if !strings.HasPrefix(event.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- event:
+		default:
+			n.drop(w)
+		}
+	}
+}
+
+// drop removes the watcher and closes its channel, the notifier must be locked
+func (n *notifier) drop(w *watcher) {
+	if _, ok := n.watchers[w]; !ok {
+		return
+	}
+	delete(n.watchers, w)
+	close(w.ch)
+	close(w.done)
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrKeyNotExists = errors.New("key not exists")
+)
+
+// EventType is the type of a change
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event is a change of key, PrevValue is nil if the key didn't exist
+type Event struct {
+	Type      EventType
+	Key       string
+	Value     []byte
+	PrevValue []byte
+}
+
+// KeyValue is a key in store with its value and the revision it was last modified at
+type KeyValue struct {
+	Key      string
+	Value    []byte
+	Revision int64
+}
+
+// Store is the storage of GPU plugin
+type Store interface {
+	// Get returns ErrKeyNotExists if the key doesn't exist
+	Get(ctx context.Context, key string) (*KeyValue, error)
+	// GetMulti skips the keys which don't exist
+	GetMulti(ctx context.Context, keys []string) ([]*KeyValue, error)
+	// GetPrefix returns all the keys with the prefix, sorted by key
+	GetPrefix(ctx context.Context, prefix string) ([]*KeyValue, error)
+	Put(ctx context.Context, key, value string) error
+	// PutWithTTL puts the key which is deleted automatically after ttl
+	PutWithTTL(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// CompareAndSwap puts the value only if the key is still at revision, 0 means the key doesn't exist,
+	// returns false if the key was modified by others
+	CompareAndSwap(ctx context.Context, key, value string, revision int64) (bool, error)
+	// CompareAndDelete deletes the key only if it's still at revision, returns false if the key was modified by others
+	CompareAndDelete(ctx context.Context, key string, revision int64) (bool, error)
+	// Watch sends the changes of the keys with the prefix, the channel is closed when ctx is done or watch fails,
+	// the receiver lagging too far behind may be regarded as a failure
+	Watch(ctx context.Context, prefix string) <-chan *Event
+	Close() error
+}
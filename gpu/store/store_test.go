@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/core/store/etcdv3/embedded"
+	coretypes "github.com/projecteru2/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "/node1")
+	assert.ErrorIs(t, err, ErrKeyNotExists)
+
+	assert.Nil(t, s.Put(ctx, "/node1", "v1"))
+	kv, err := s.Get(ctx, "/node1")
+	assert.Nil(t, err)
+	assert.Equal(t, "/node1", kv.Key)
+	assert.Equal(t, []byte("v1"), kv.Value)
+
+	assert.Nil(t, s.Put(ctx, "/node2", "v2"))
+	kvs, err := s.GetMulti(ctx, []string{"/node1", "/node2"})
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 2)
+	// the missing keys are skipped
+	kvs, err = s.GetMulti(ctx, []string{"/node1", "/node3"})
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+
+	assert.Nil(t, s.Put(ctx, "/node10", "v10"))
+	kvs, err = s.GetPrefix(ctx, "/node1")
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 2)
+	assert.Equal(t, "/node1", kvs[0].Key)
+	assert.Equal(t, "/node10", kvs[1].Key)
+	assert.Nil(t, s.Delete(ctx, "/node10"))
+
+	// swap fails with a stale revision
+	ok, err := s.CompareAndSwap(ctx, "/node1", "v3", kv.Revision)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = s.CompareAndSwap(ctx, "/node1", "v4", kv.Revision)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	kv, err = s.Get(ctx, "/node1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), kv.Value)
+
+	// revision 0 means the key doesn't exist
+	ok, err = s.CompareAndSwap(ctx, "/node2", "v5", 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = s.CompareAndSwap(ctx, "/node3", "v5", 0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.Nil(t, s.Delete(ctx, "/node3"))
+	_, err = s.Get(ctx, "/node3")
+	assert.ErrorIs(t, err, ErrKeyNotExists)
+
+	// delete fails with a stale revision too
+	kv, err = s.Get(ctx, "/node1")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put(ctx, "/node1", "v6"))
+	ok, err = s.CompareAndDelete(ctx, "/node1", kv.Revision)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	kv, err = s.Get(ctx, "/node1")
+	assert.Nil(t, err)
+	ok, err = s.CompareAndDelete(ctx, "/node1", kv.Revision)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, err = s.Get(ctx, "/node1")
+	assert.ErrorIs(t, err, ErrKeyNotExists)
+}
+
+func testWatch(t *testing.T, s Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := s.Watch(ctx, "/watch/")
+
+	assert.Nil(t, s.Put(ctx, "/watch/node1", "v1"))
+	assert.Nil(t, s.Put(ctx, "/others", "v1"))
+	assert.Nil(t, s.Put(ctx, "/watch/node1", "v2"))
+	assert.Nil(t, s.Delete(ctx, "/watch/node1"))
+
+	event := <-ch
+	assert.Equal(t, &Event{Type: EventPut, Key: "/watch/node1", Value: []byte("v1")}, event)
+	event = <-ch
+	assert.Equal(t, &Event{Type: EventPut, Key: "/watch/node1", Value: []byte("v2"), PrevValue: []byte("v1")}, event)
+	event = <-ch
+	assert.Equal(t, &Event{Type: EventDelete, Key: "/watch/node1", PrevValue: []byte("v2")}, event)
+
+	// the channel is closed when ctx is done
+	cancel()
+	for range ch {
+	}
+}
+
+// testLaggingWatch checks a watcher which never reads doesn't block the writes
+func testLaggingWatch(t *testing.T, s Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := s.Watch(ctx, "/lagging/")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i <= watchBufferSize; i++ {
+			assert.Nil(t, s.Put(context.Background(), "/lagging/node1", "v1"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes are blocked by the lagging watcher")
+	}
+
+	// the buffered events are kept, then the channel is closed
+	count := 0
+	for range ch {
+		count++
+	}
+	assert.Equal(t, watchBufferSize, count)
+}
+
+func testTTL(t *testing.T, s Store) {
+	ctx := context.Background()
+	assert.Nil(t, s.PutWithTTL(ctx, "/ttl/node1", "v1", time.Second))
+	assert.Nil(t, s.PutWithTTL(ctx, "/ttl/node2", "v1", time.Second))
+	// the key modified again is kept
+	assert.Nil(t, s.Put(ctx, "/ttl/node2", "v2"))
+	kv, err := s.Get(ctx, "/ttl/node1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), kv.Value)
+
+	assert.Eventually(t, func() bool {
+		_, err := s.Get(ctx, "/ttl/node1")
+		return errors.Is(err, ErrKeyNotExists)
+	}, 5*time.Second, 100*time.Millisecond)
+	kv, err = s.Get(ctx, "/ttl/node2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), kv.Value)
+
+	// the expired key is missing for all the reads and writes
+	assert.Nil(t, s.PutWithTTL(ctx, "/ttl/node3", "v1", time.Second))
+	time.Sleep(2 * time.Second)
+	kvs, err := s.GetPrefix(ctx, "/ttl/")
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+	ok, err := s.CompareAndSwap(ctx, "/ttl/node3", "v2", 0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	kv, err = s.Get(ctx, "/ttl/node3")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), kv.Value)
+}
+
+func TestETCD(t *testing.T) {
+	s := NewETCDWithClient(embedded.NewCluster(t, "/gpu").RandClient())
+	testStore(t, s)
+	testWatch(t, s)
+	testTTL(t, s)
+	assert.Nil(t, s.Close())
+
+	_, err := NewETCD(coretypes.EtcdConfig{})
+	assert.ErrorIs(t, err, coretypes.ErrConfigInvaild)
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+	testWatch(t, NewMemory())
+	testLaggingWatch(t, NewMemory())
+	testTTL(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpu.db")
+	s, err := NewFile(path)
+	assert.Nil(t, err)
+	testStore(t, s)
+	testWatch(t, s)
+	testLaggingWatch(t, s)
+	testTTL(t, s)
+	assert.Nil(t, s.PutWithTTL(context.Background(), "/ttl/node4", "v1", time.Second))
+	assert.Nil(t, s.Close())
+
+	// the keys are kept after reopening, but the ones with ttl still expire
+	time.Sleep(time.Second)
+	s, err = NewFile(path)
+	assert.Nil(t, err)
+	kv, err := s.Get(context.Background(), "/node2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), kv.Value)
+	_, err = s.Get(context.Background(), "/ttl/node4")
+	assert.ErrorIs(t, err, ErrKeyNotExists)
+	assert.Nil(t, s.Close())
+}
@@ -0,0 +1,14 @@
+// Package storetest provides the stores for the tests of plugin
+package storetest
+
+import (
+	"testing"
+
+	"github.com/projecteru2/core/store/etcdv3/embedded"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+)
+
+// NewETCD returns the store on the embedded etcd cluster, which is cached per test and namespaced by prefix
+func NewETCD(t *testing.T, prefix string) store.Store {
+	return store.NewETCDWithClient(embedded.NewCluster(t, prefix).RandClient())
+}
@@ -0,0 +1,140 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/docker/go-units"
+)
+
+// ProductInfo describes a GPU product in catalog
+type ProductInfo struct {
+	Vendor string `yaml:"vendor" json:"vendor"`
+	Arch   string `yaml:"arch" json:"arch"`
+	// VRAM is the VRAM per card in bytes
+	VRAM              int64  `yaml:"vram" json:"vram"`
+	ComputeCapability string `yaml:"compute_capability" json:"compute_capability"`
+	Interconnect      string `yaml:"interconnect" json:"interconnect"`
+	// Weight is how scarce or expensive the product is when the idleness of nodes is scored,
+	// it's computed from the totals of the nodes to choose from if not set
+	Weight float64 `yaml:"weight" json:"weight"`
+}
+
+// attr returns the value of the attribute, ok is false if the attribute is unknown
+func (pi ProductInfo) attr(prod string, name string) (value string, ok bool) {
+	switch name {
+	case "product":
+		return prod, true
+	case "vendor":
+		return pi.Vendor, true
+	case "arch":
+		return pi.Arch, true
+	case "vram":
+		return strconv.FormatInt(pi.VRAM, 10), true
+	case "compute_capability":
+		return pi.ComputeCapability, true
+	case "interconnect":
+		return pi.Interconnect, true
+	}
+	return "", false
+}
+
+// operators are ordered to match the longer ones first
+var operators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// Constraint is a condition on an attribute of product, e.g. compute_capability >= 8.0
+type Constraint struct {
+	Attr  string
+	Op    string
+	Value string
+}
+
+// IsConstraint returns true if the product in request is a list of constraints
+func IsConstraint(prod string) bool {
+	return strings.ContainsAny(prod, "=<>")
+}
+
+// ParseConstraints parses constraints separated by comma, e.g. "vendor == nvidia, compute_capability >= 8.0"
+func ParseConstraints(expr string) ([]Constraint, error) {
+	constraints := []Constraint{}
+	for _, cond := range strings.Split(expr, ",") {
+		constraint, err := parseConstraint(strings.TrimSpace(cond))
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints, nil
+}
+
+func parseConstraint(cond string) (Constraint, error) {
+	for _, op := range operators {
+		idx := strings.Index(cond, op)
+		if idx < 0 {
+			continue
+		}
+		constraint := Constraint{
+			Attr:  strings.ToLower(strings.TrimSpace(cond[:idx])),
+			Op:    op,
+			Value: strings.Trim(strings.TrimSpace(cond[idx+len(op):]), `"'`),
+		}
+		if _, ok := (ProductInfo{}).attr("", constraint.Attr); !ok {
+			return constraint, errors.Wrapf(ErrInvalidConstraint, "unknown attribute %s", constraint.Attr)
+		}
+		if constraint.Value == "" {
+			return constraint, errors.Wrapf(ErrInvalidConstraint, "%s: value is empty", cond)
+		}
+		if _, _, err := constraint.numbers("0"); err != nil && op != "==" && op != "!=" {
+			return constraint, errors.Wrapf(ErrInvalidConstraint, "%s: %s only works on numbers", cond, op)
+		}
+		return constraint, nil
+	}
+	return Constraint{}, errors.Wrapf(ErrInvalidConstraint, "%s: no operator", cond)
+}
+
+// numbers converts the value of product and the value of constraint to numbers,
+// the value of vram can be human readable, e.g. 40GiB
+func (c Constraint) numbers(value string) (float64, float64, error) {
+	left, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c.Attr == "vram" {
+		right, err := units.RAMInBytes(c.Value)
+		return left, float64(right), err
+	}
+	right, err := strconv.ParseFloat(c.Value, 64)
+	return left, right, err
+}
+
+// Match returns true if the product satisfies the constraint
+func (c Constraint) Match(prod string, info ProductInfo) bool {
+	value, ok := info.attr(prod, c.Attr)
+	if !ok {
+		return false
+	}
+	if left, right, err := c.numbers(value); err == nil {
+		switch c.Op {
+		case ">=":
+			return left >= right
+		case "<=":
+			return left <= right
+		case ">":
+			return left > right
+		case "<":
+			return left < right
+		case "==":
+			return left == right
+		case "!=":
+			return left != right
+		}
+	}
+	switch c.Op {
+	case "==":
+		return strings.EqualFold(value, c.Value)
+	case "!=":
+		return !strings.EqualFold(value, c.Value)
+	}
+	return false
+}
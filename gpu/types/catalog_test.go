@@ -0,0 +1,50 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/docker/go-units"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConstraints(t *testing.T) {
+	constraints, err := ParseConstraints("vendor == nvidia, compute_capability>=8.0")
+	assert.Nil(t, err)
+	assert.Equal(t, []Constraint{
+		{Attr: "vendor", Op: "==", Value: "nvidia"},
+		{Attr: "compute_capability", Op: ">=", Value: "8.0"},
+	}, constraints)
+
+	for _, expr := range []string{
+		"vendor",
+		"color == red",
+		"vendor ==",
+		"vendor >= nvidia",
+		"vendor == nvidia, ",
+	} {
+		_, err := ParseConstraints(expr)
+		assert.ErrorIs(t, err, ErrInvalidConstraint, expr)
+	}
+}
+
+func TestConstraintMatch(t *testing.T) {
+	a100 := ProductInfo{
+		Vendor:            "NVIDIA",
+		Arch:              "ampere",
+		VRAM:              40 * units.GiB,
+		ComputeCapability: "8.0",
+		Interconnect:      "nvlink",
+	}
+	match := func(expr string) bool {
+		constraints, err := ParseConstraints(expr)
+		assert.Nil(t, err)
+		return matchAll(constraints, "nvidia-a100", a100)
+	}
+	assert.True(t, match("vendor == nvidia"))
+	assert.True(t, match("compute_capability >= 8.0"))
+	assert.False(t, match("compute_capability > 8.0"))
+	assert.True(t, match("vram >= 40GiB, interconnect == nvlink"))
+	assert.False(t, match("vram > 40GiB"))
+	assert.True(t, match("arch != hopper"))
+	assert.True(t, match("product == nvidia-a100"))
+}
@@ -0,0 +1,205 @@
+package types
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jinzhu/configor"
+)
+
+const (
+	// StrategySpread balances the load, the node with the lowest usage is preferred
+	StrategySpread = "spread"
+	// StrategyBinpack fills the nodes, the node with the highest usage is preferred to keep whole nodes free
+	StrategyBinpack = "binpack"
+	// StrategyBestfit prefers the node which leaves the least free GPUs of the requested products
+	StrategyBestfit = "bestfit"
+
+	// StorageETCD keeps the resource info in the etcd of eru-core config
+	StorageETCD = "etcd"
+	// StorageMemory keeps the resource info in memory, it's lost when the process exits
+	StorageMemory = "memory"
+	// StorageFile keeps the resource info in a single local file
+	StorageFile = "file"
+)
+
+// Config is the config of GPU plugin, it's the `gpu` section of the config file
+type Config struct {
+	// Aliases maps a name to a list of products, e.g. ampere-consumer: [nvidia-3070, nvidia-3080, nvidia-3090]
+	Aliases map[string][]string `yaml:"aliases" json:"aliases"`
+	// Products is the product catalog, if it's not empty, the products not in it will be rejected
+	Products  map[string]ProductInfo `yaml:"products" json:"products"`
+	Scheduler SchedulerConfig        `yaml:"scheduler" json:"scheduler"`
+	Storage   StorageConfig          `yaml:"storage" json:"storage"`
+	History   HistoryConfig          `yaml:"history" json:"history"`
+	// Provisional is the config of the provisional reservations made by CalculateDeploy
+	Provisional ProvisionalConfig `yaml:"provisional" json:"provisional"`
+}
+
+// SchedulerConfig is the config of placement
+type SchedulerConfig struct {
+	// Strategy is one of spread, binpack and bestfit, spread by default
+	Strategy string `yaml:"strategy" json:"strategy" default:"spread"`
+	// Weight is the weight of GPU when eru-core averages the usage of all resources, 1 by default
+	Weight float64 `yaml:"weight" json:"weight" default:"1"`
+	// Strict fails GetNodesDeployCapacity and GetMostIdleNode if any node is not found, corrupt,
+	// or has no GPU while GPU is requested, otherwise these nodes are skipped and reported in diagnostics
+	Strict bool `yaml:"strict" json:"strict"`
+	// SkipUnavailable skips the nodes not found or corrupt in the calls of eru-core, which fail on them by default,
+	// the nodes skipped are only logged since eru-core can't get the diagnostics
+	SkipUnavailable bool `yaml:"skip_unavailable" json:"skip_unavailable"`
+}
+
+// StorageConfig is the config of the storage of node resource info
+type StorageConfig struct {
+	// Type is one of etcd, memory and file, etcd by default
+	Type string `yaml:"type" json:"type" default:"etcd"`
+	// Path is the path of the file, only used by file storage
+	Path string `yaml:"path" json:"path"`
+}
+
+// HistoryConfig is the config of the change history of nodes
+type HistoryConfig struct {
+	// MaxRecords is the max number of records kept for each node, the oldest ones are dropped, 100 by default
+	MaxRecords int `yaml:"max_records" json:"max_records" default:"100"`
+}
+
+// ProvisionalConfig is the config of provisional reservations, the GPUs planned by CalculateDeploy are reserved
+// until eru-core sets the usage of the workloads, so the parallel deployments won't pick the same GPUs.
+type ProvisionalConfig struct {
+	// TTL is how long a reservation is held if it's never confirmed, 0 by default which disables the reservations
+	TTL time.Duration `yaml:"ttl" json:"ttl"`
+}
+
+// Validate .
+func (c *Config) Validate() error {
+	switch c.Scheduler.Strategy {
+	case "", StrategySpread, StrategyBinpack, StrategyBestfit:
+	default:
+		return errors.Wrapf(ErrInvalidConfig, "unknown strategy %s", c.Scheduler.Strategy)
+	}
+	if c.Scheduler.Weight < 0 {
+		return errors.Wrapf(ErrInvalidConfig, "weight can't be negative")
+	}
+	switch c.Storage.Type {
+	case "", StorageETCD, StorageMemory:
+	case StorageFile:
+		if c.Storage.Path == "" {
+			return errors.Wrapf(ErrInvalidConfig, "path of file storage is empty")
+		}
+	default:
+		return errors.Wrapf(ErrInvalidConfig, "unknown storage %s", c.Storage.Type)
+	}
+	if c.History.MaxRecords < 0 {
+		return errors.Wrapf(ErrInvalidConfig, "max records of history can't be negative")
+	}
+	if c.Provisional.TTL < 0 {
+		return errors.Wrapf(ErrInvalidConfig, "ttl of provisional reservations can't be negative")
+	}
+	for prod, info := range c.Products {
+		if info.Weight < 0 {
+			return errors.Wrapf(ErrInvalidConfig, "weight of %s can't be negative", prod)
+		}
+	}
+	return nil
+}
+
+// Strategy returns the placement strategy, spread if it's not set
+func (c *Config) Strategy() string {
+	if c.Scheduler.Strategy == "" {
+		return StrategySpread
+	}
+	return c.Scheduler.Strategy
+}
+
+// Weight returns the weight of GPU, 1 if it's not set
+func (c *Config) Weight() float64 {
+	if c.Scheduler.Weight == 0 {
+		return 1
+	}
+	return c.Scheduler.Weight
+}
+
+// MaxHistoryRecords returns the max number of history records of each node, 100 if it's not set
+func (c *Config) MaxHistoryRecords() int {
+	if c.History.MaxRecords == 0 {
+		return 100
+	}
+	return c.History.MaxRecords
+}
+
+// LoadConfig loads the `gpu` section of the config file
+func LoadConfig(configPath string) (*Config, error) {
+	config := struct {
+		GPU Config `yaml:"gpu"`
+	}{}
+	if err := configor.Load(&config, configPath); err != nil {
+		return nil, err
+	}
+	return &config.GPU, nil
+}
+
+// IsProdPattern returns true if the product in request is an alias, a wildcard pattern like nvidia-*
+// or a list of constraints like vendor == nvidia
+func (c *Config) IsProdPattern(prod string) bool {
+	if _, ok := c.Aliases[prod]; ok {
+		return true
+	}
+	return strings.ContainsAny(prod, "*?[") || IsConstraint(prod)
+}
+
+// IsKnownProd returns true if the product is in catalog or there is no catalog
+func (c *Config) IsKnownProd(prod string) bool {
+	if len(c.Products) == 0 {
+		return true
+	}
+	_, ok := c.Products[prod]
+	return ok
+}
+
+// MatchProds returns the products matched by the alias, the wildcard pattern or the constraints,
+// the products of an alias keep the order in config, and the others are sorted by name.
+func (c *Config) MatchProds(pattern string, prods []string) []string {
+	res := []string{}
+	if IsConstraint(pattern) {
+		// the constraints have been validated with request
+		constraints, _ := ParseConstraints(pattern)
+		for _, prod := range prods {
+			if info, ok := c.Products[prod]; ok && matchAll(constraints, prod, info) {
+				res = append(res, prod)
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+	if alias, ok := c.Aliases[pattern]; ok {
+		for _, prod := range alias {
+			for _, p := range prods {
+				if p == prod {
+					res = append(res, prod)
+					break
+				}
+			}
+		}
+		return res
+	}
+	for _, prod := range prods {
+		if matched, err := path.Match(pattern, prod); err == nil && matched {
+			res = append(res, prod)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func matchAll(constraints []Constraint, prod string, info ProductInfo) bool {
+	for _, constraint := range constraints {
+		if !constraint.Match(prod, info) {
+			return false
+		}
+	}
+	return true
+}
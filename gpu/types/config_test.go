@@ -0,0 +1,122 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "gpu.yaml")
+	content := `
+etcd:
+    prefix: "/eru-gpu"
+
+gpu:
+    aliases:
+        ampere-consumer:
+            - nvidia-3090
+            - nvidia-3070
+    provisional:
+        ttl: 30s
+`
+	assert.Nil(t, os.WriteFile(configPath, []byte(content), 0600))
+	config, err := LoadConfig(configPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nvidia-3090", "nvidia-3070"}, config.Aliases["ampere-consumer"])
+	assert.Equal(t, 30*time.Second, config.Provisional.TTL)
+}
+
+func TestMatchProds(t *testing.T) {
+	config := &Config{
+		Aliases: map[string][]string{
+			"ampere-consumer": {"nvidia-3090", "nvidia-3080", "nvidia-3070"},
+		},
+	}
+	prods := []string{"nvidia-3070", "nvidia-3090", "nvidia-a100", "amd-mi250"}
+
+	assert.True(t, config.IsProdPattern("ampere-consumer"))
+	assert.True(t, config.IsProdPattern("nvidia-*"))
+	assert.False(t, config.IsProdPattern("nvidia-3070"))
+
+	// the order of alias is kept
+	assert.Equal(t, []string{"nvidia-3090", "nvidia-3070"}, config.MatchProds("ampere-consumer", prods))
+	assert.Equal(t, []string{"nvidia-3070", "nvidia-3090", "nvidia-a100"}, config.MatchProds("nvidia-*", prods))
+	assert.Equal(t, []string{"nvidia-3070", "nvidia-3090"}, config.MatchProds("nvidia-30*", prods))
+	assert.Equal(t, []string{}, config.MatchProds("intel-*", prods))
+}
+
+func TestMatchProdsByConstraints(t *testing.T) {
+	config := &Config{
+		Products: map[string]ProductInfo{
+			"nvidia-3070": {Vendor: "nvidia", ComputeCapability: "8.6"},
+			"nvidia-v100": {Vendor: "nvidia", ComputeCapability: "7.0"},
+			"amd-mi250":   {Vendor: "amd"},
+		},
+	}
+	prods := []string{"nvidia-3070", "nvidia-v100", "amd-mi250", "nvidia-a100"}
+	assert.True(t, config.IsProdPattern("vendor == nvidia"))
+	assert.Equal(t, []string{"nvidia-3070", "nvidia-v100"}, config.MatchProds("vendor == nvidia", prods))
+	// the products not in catalog never match
+	assert.Equal(t, []string{"nvidia-3070"}, config.MatchProds("vendor == nvidia, compute_capability >= 8.0", prods))
+
+	assert.True(t, config.IsKnownProd("amd-mi250"))
+	assert.False(t, config.IsKnownProd("nvidai-3070"))
+	assert.True(t, (&Config{}).IsKnownProd("nvidai-3070"))
+}
+
+func TestSchedulerConfig(t *testing.T) {
+	config := &Config{}
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, StrategySpread, config.Strategy())
+	assert.Equal(t, float64(1), config.Weight())
+
+	config.Scheduler = SchedulerConfig{Strategy: StrategyBinpack, Weight: 0.5}
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, StrategyBinpack, config.Strategy())
+	assert.Equal(t, 0.5, config.Weight())
+
+	config.Scheduler.Strategy = "random"
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+	config.Scheduler = SchedulerConfig{Weight: -1}
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+}
+
+func TestStorageConfig(t *testing.T) {
+	config := &Config{}
+	assert.Nil(t, config.Validate())
+
+	config.Storage = StorageConfig{Type: StorageMemory}
+	assert.Nil(t, config.Validate())
+
+	config.Storage = StorageConfig{Type: StorageFile}
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+	config.Storage.Path = "/tmp/gpu.db"
+	assert.Nil(t, config.Validate())
+
+	config.Storage = StorageConfig{Type: "redis"}
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+}
+
+func TestHistoryConfig(t *testing.T) {
+	config := &Config{}
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, 100, config.MaxHistoryRecords())
+
+	config.History.MaxRecords = 10
+	assert.Equal(t, 10, config.MaxHistoryRecords())
+	config.History.MaxRecords = -1
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+}
+
+func TestProvisionalConfig(t *testing.T) {
+	config := &Config{}
+	assert.Nil(t, config.Validate())
+	config.Provisional.TTL = time.Minute
+	assert.Nil(t, config.Validate())
+	config.Provisional.TTL = -time.Minute
+	assert.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+)
+
+const (
+	// DiagnosticNotFound means the node is not added to the plugin, e.g. a typo of nodename
+	DiagnosticNotFound = "not-found"
+	// DiagnosticCorrupt means the resource info of node can't be decoded or is invalid
+	DiagnosticCorrupt = "corrupt"
+	// DiagnosticZeroCapacity means the node has no GPU at all
+	DiagnosticZeroCapacity = "zero-capacity"
+)
+
+// NodeDiagnostic is a problem of node found in batch lookups
+type NodeDiagnostic struct {
+	Nodename string `json:"nodename"`
+	Problem  string `json:"problem"`
+	Message  string `json:"message,omitempty"`
+}
+
+func (d *NodeDiagnostic) String() string {
+	if d.Message == "" {
+		return fmt.Sprintf("%s: %s", d.Nodename, d.Problem)
+	}
+	return fmt.Sprintf("%s: %s, %s", d.Nodename, d.Problem, d.Message)
+}
+
+// DiagnosticsError returns ErrUnavailableNodes with all the diagnostics, nil if there is none
+func DiagnosticsError(diagnostics []*NodeDiagnostic) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, d := range diagnostics {
+		msgs = append(msgs, d.String())
+	}
+	return errors.Wrap(ErrUnavailableNodes, strings.Join(msgs, "; "))
+}
+
+// NodesDeployCapacityResponse is GetNodesDeployCapacityResponse with the diagnostics of nodes,
+// and the explanations of capacity of the nodes found in explain mode
+type NodesDeployCapacityResponse struct {
+	*plugintypes.GetNodesDeployCapacityResponse
+	Diagnostics  []*NodeDiagnostic           `json:"diagnostics"`
+	Explanations map[string]*NodeExplanation `json:"explanations,omitempty"`
+}
+
+// MostIdleNodeResponse is GetMostIdleNodeResponse with the diagnostics of nodes
+type MostIdleNodeResponse struct {
+	*plugintypes.GetMostIdleNodeResponse
+	Diagnostics []*NodeDiagnostic `json:"diagnostics"`
+}
@@ -8,11 +8,25 @@ import (
 // EngineParams .
 type EngineParams struct {
 	ProdCountMap ProdCountMap `json:"prod_count_map" mapstructure:"prod_count_map"`
+	// GPUMap is the devices which should be passed through to the workload
+	GPUMap GPUMap `json:"gpu_map" mapstructure:"gpu_map"`
+	// NUMANode is set when all the devices are on the same NUMA node
+	NUMANode string `json:"numa_node" mapstructure:"numa_node"`
+	// VRAMMap is the VRAM limit of the shared devices in GPUMap
+	VRAMMap VRAMMap `json:"vram_map" mapstructure:"vram_map"`
+	// MIGMap is the MIG instances which should be passed through to the workload
+	MIGMap MIGMap `json:"mig_map" mapstructure:"mig_map"`
+	Remap  bool   `json:"remap" mapstructure:"remap"`
 }
 
 func (ep *EngineParams) AsRawParams() resourcetypes.RawParams {
 	return resourcetypes.RawParams{
 		"prod_count_map": ep.ProdCountMap,
+		"gpu_map":        ep.GPUMap,
+		"numa_node":      ep.NUMANode,
+		"vram_map":       ep.VRAMMap,
+		"mig_map":        ep.MIGMap,
+		"remap":          ep.Remap,
 	}
 }
 
@@ -27,13 +41,24 @@ func (ep *EngineParams) Count() int {
 func (ep *EngineParams) DeepCopy() *EngineParams {
 	return &EngineParams{
 		ProdCountMap: ep.ProdCountMap.DeepCopy(),
+		GPUMap:       ep.GPUMap.DeepCopy(),
+		NUMANode:     ep.NUMANode,
+		VRAMMap:      ep.VRAMMap.DeepCopy(),
+		MIGMap:       ep.MIGMap.DeepCopy(),
+		Remap:        ep.Remap,
 	}
 }
 
 func (ep *EngineParams) Sub(ep1 *EngineParams) {
 	ep.ProdCountMap.Sub(ep1.ProdCountMap)
+	ep.GPUMap.Sub(ep1.GPUMap)
+	ep.VRAMMap.Sub(ep1.VRAMMap)
+	ep.MIGMap.Sub(ep1.MIGMap)
 }
 
 func (ep *EngineParams) Add(ep1 *EngineParams) {
 	ep.ProdCountMap.Add(ep1.ProdCountMap)
+	ep.GPUMap.Add(ep1.GPUMap)
+	ep.VRAMMap.Add(ep1.VRAMMap)
+	ep.MIGMap.Add(ep1.MIGMap)
 }
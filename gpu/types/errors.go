@@ -3,8 +3,25 @@ package types
 import "github.com/cockroachdb/errors"
 
 var (
-	ErrInvalidCapacity   = errors.New("invalid resource capacity")
-	ErrInvalidGPUMap     = errors.New("invalid gpu map")
-	ErrInvalidGPU        = errors.New("invalid gpu")
-	ErrInvalidGPUProduct = errors.New("invalid gpu product")
+	ErrInvalidCapacity      = errors.New("invalid resource capacity")
+	ErrInvalidGPUMap        = errors.New("invalid gpu map")
+	ErrInvalidGPU           = errors.New("invalid gpu")
+	ErrInvalidCount         = errors.New("invalid count")
+	ErrQuotaExceeded        = errors.New("gpu quota exceeded")
+	ErrQuotaNotExists       = errors.New("quota not exists")
+	ErrInvalidQuota         = errors.New("invalid quota")
+	ErrInvalidGPUProduct    = errors.New("invalid gpu product")
+	ErrInvalidNUMA          = errors.New("invalid numa")
+	ErrInvalidVRAM          = errors.New("invalid vram")
+	ErrInvalidMIG           = errors.New("invalid mig")
+	ErrInvalidConstraint    = errors.New("invalid constraint")
+	ErrInvalidConfig        = errors.New("invalid config")
+	ErrConflict             = errors.New("node resource info was modified concurrently")
+	ErrInvalidSnapshot      = errors.New("invalid snapshot")
+	ErrUnavailableNodes     = errors.New("unavailable nodes")
+	ErrInvalidReservation   = errors.New("invalid reservation")
+	ErrReservationNotExists = errors.New("reservation not exists")
+	ErrInvalidPriority      = errors.New("invalid priority")
+	ErrInvalidGang          = errors.New("invalid gang")
+	ErrAllocationsExist     = errors.New("allocations exist")
 )
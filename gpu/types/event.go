@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+const (
+	EventNodeAdded       = "node-added"
+	EventNodeRemoved     = "node-removed"
+	EventCapacityChanged = "capacity-changed"
+	EventUsageChanged    = "usage-changed"
+)
+
+// NodeEvent is a change of the resource of node
+type NodeEvent struct {
+	Type     string    `json:"type"`
+	Nodename string    `json:"nodename"`
+	Time     time.Time `json:"time"`
+	// Capacity and Usage are the resource after the change, or before the node is removed
+	Capacity *NodeResource `json:"capacity,omitempty"`
+	Usage    *NodeResource `json:"usage,omitempty"`
+	// Delta is the per-product change of capacity or usage
+	Delta ProdCountMap `json:"delta,omitempty"`
+}
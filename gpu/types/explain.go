@@ -0,0 +1,77 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	coretypes "github.com/projecteru2/core/types"
+)
+
+const (
+	// ExplainCount is a product requested by count
+	ExplainCount = "count"
+	// ExplainVRAM is a product requested by VRAM slice, the amounts are in bytes
+	ExplainVRAM = "vram"
+	// ExplainMIG is a MIG profile requested by count
+	ExplainMIG = "mig"
+	// ExplainFlexible is an alias, pattern, constraint or min vram request, which can be satisfied by several products
+	ExplainFlexible = "flexible"
+)
+
+// ProdExplanation is how many workloads a product of the request allows on a node
+type ProdExplanation struct {
+	Product string `json:"product"`
+	Kind    string `json:"kind"`
+	// Requested is the amount requested by each workload, Available is the free amount on the node
+	Requested int64 `json:"requested"`
+	Available int64 `json:"available"`
+	Capacity  int   `json:"capacity"`
+}
+
+// NodeExplanation explains the deploy capacity of a node
+type NodeExplanation struct {
+	Nodename string `json:"nodename"`
+	Capacity int    `json:"capacity"`
+	// Alternative is the alternative the capacity is calculated by, nil if the request has no alternatives
+	Alternative ProdCountMap       `json:"alternative,omitempty"`
+	Products    []*ProdExplanation `json:"products"`
+	// Limit is the product which limits the capacity, empty if the request doesn't need GPU
+	Limit string `json:"limit"`
+}
+
+// Limiting returns the explanation of the limiting product, nil if there is none
+func (e *NodeExplanation) Limiting() *ProdExplanation {
+	for _, prod := range e.Products {
+		if prod.Product == e.Limit {
+			return prod
+		}
+	}
+	return nil
+}
+
+func (e *NodeExplanation) String() string {
+	msg := fmt.Sprintf("node %s: capacity %d", e.Nodename, e.Capacity)
+	if limiting := e.Limiting(); limiting != nil {
+		msg += fmt.Sprintf(", limited by %s %s (requested %d, available %d)", limiting.Kind, limiting.Product, limiting.Requested, limiting.Available)
+	}
+	return msg
+}
+
+// InsufficientResourceError is ErrInsufficientResource of eru-core with the explanation of node
+type InsufficientResourceError struct {
+	DeployCount int
+	Explanation *NodeExplanation
+}
+
+func (e *InsufficientResourceError) Error() string {
+	details := []string{fmt.Sprintf("deploy %d workloads", e.DeployCount)}
+	if e.Explanation != nil {
+		details = append(details, e.Explanation.String())
+	}
+	return fmt.Sprintf("%s: %s", coretypes.ErrInsufficientResource.Error(), strings.Join(details, ", "))
+}
+
+// Unwrap makes errors.Is(err, ErrInsufficientResource) work
+func (e *InsufficientResourceError) Unwrap() error {
+	return coretypes.ErrInsufficientResource
+}
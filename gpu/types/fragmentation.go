@@ -0,0 +1,39 @@
+package types
+
+// ProdFragmentation is how scattered the free GPUs of a product are across nodes.
+// Fragmentation is measured only against the largest size requested, the smaller sizes are only reported by Satisfiable:
+// Fragmentation = 1 - Satisfiable[largest] * largest / Free
+type ProdFragmentation struct {
+	Product  string `json:"product"`
+	Capacity int    `json:"capacity"`
+	Free     int    `json:"free"`
+	// LargestFreeBlock is the most free GPUs on a single node
+	LargestFreeBlock int `json:"largest_free_block"`
+	// Satisfiable is how many requests of N GPUs on a single node can be deployed, by N
+	Satisfiable map[int]int `json:"satisfiable"`
+	// Fragmentation is the share of free GPUs which can't be used by the requests of the largest size, 0 if nothing is free
+	Fragmentation float64 `json:"fragmentation"`
+}
+
+// Migration moves the workload of the allocation from a node to another
+type Migration struct {
+	AllocID      string       `json:"alloc_id"`
+	From         string       `json:"from"`
+	To           string       `json:"to"`
+	ProdCountMap ProdCountMap `json:"prod_count_map"`
+}
+
+// DefragPlan is the migrations to free whole nodes, the plugin doesn't move the workloads,
+// eru-core or the operator carries it out.
+type DefragPlan struct {
+	Migrations []*Migration `json:"migrations"`
+	// FreedNodes are the nodes without any workload after the migrations
+	FreedNodes []string `json:"freed_nodes"`
+}
+
+// FragmentationReport is the fragmentation of each product and the plan to reduce it
+type FragmentationReport struct {
+	Products    []*ProdFragmentation `json:"products"`
+	Plan        *DefragPlan          `json:"plan"`
+	Diagnostics []*NodeDiagnostic    `json:"diagnostics,omitempty"`
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+)
+
+// NodeLabels describes where a node is, e.g. rack=r1, zone=z1, the gang members can be kept under a label
+type NodeLabels map[string]string
+
+// Validate .
+func (l NodeLabels) Validate() error {
+	for key := range l {
+		if strings.TrimSpace(key) == "" {
+			return errors.Wrap(ErrInvalidGang, "label is empty")
+		}
+	}
+	return nil
+}
+
+// DeepCopy .
+func (l NodeLabels) DeepCopy() NodeLabels {
+	res := NodeLabels{}
+	for key, value := range l {
+		res[key] = value
+	}
+	return res
+}
+
+// GangPlan deploys all the members of a gang across nodes, it's planned all or nothing
+type GangPlan struct {
+	Members int `json:"members"`
+	// Group is the value of the label all the nodes share, empty if the gang isn't kept under a label
+	Group string `json:"group,omitempty"`
+	// NodeCountMap is the number of members on each node
+	NodeCountMap map[string]int `json:"node_count_map"`
+	// Nodes is the plan of the members on each node, the same as the response of CalculateDeploy
+	Nodes map[string]*plugintypes.CalculateDeployResponse `json:"nodes"`
+}
@@ -1,11 +1,16 @@
 package types
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/cockroachdb/errors"
 )
 
+// MaxMIGSlices is the number of compute slices of a GPU which supports MIG
+const MaxMIGSlices = 7
+
 type ProdCountMap map[string]int
 
 func (pcm ProdCountMap) Validate() error {
@@ -80,5 +85,428 @@ func (pcm ProdCountMap) TotalCount() int {
 	return totalCount
 }
 
+// Keys returns the products sorted
+func (pcm ProdCountMap) Keys() []string {
+	keys := make([]string, 0, len(pcm))
+	for key := range pcm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// VRAMMap map[address]vram or map[product]vram, vram is in bytes
+type VRAMMap map[string]int64
+
+func (vm VRAMMap) Validate() error {
+	for key, vram := range vm {
+		if strings.Trim(key, " ") == "" {
+			return errors.Wrapf(ErrInvalidVRAM, "key is empty")
+		}
+		if vram <= 0 {
+			return errors.Wrapf(ErrInvalidVRAM, "vram is less or equal to zero: <key: %s, vram: %d>", key, vram)
+		}
+	}
+	return nil
+}
+
+func (vm VRAMMap) Add(vm1 VRAMMap) {
+	for key, vram := range vm1 {
+		vm[key] += vram
+		if vm[key] == 0 {
+			delete(vm, key)
+		}
+	}
+}
+
+func (vm VRAMMap) Sub(vm1 VRAMMap) {
+	for key, vram := range vm1 {
+		vm[key] -= vram
+		if vm[key] == 0 {
+			delete(vm, key)
+		}
+	}
+}
+
+func (vm VRAMMap) RemoveLTE0() {
+	for k, v := range vm {
+		if v <= 0 {
+			delete(vm, k)
+		}
+	}
+}
+
+func (vm VRAMMap) DeepCopy() VRAMMap {
+	cp := make(VRAMMap)
+	for k, v := range vm {
+		cp[k] = v
+	}
+	return cp
+}
+
+func (vm VRAMMap) Total() int64 {
+	var total int64
+	for _, vram := range vm {
+		total += vram
+	}
+	return total
+}
+
+// Keys returns the addresses or products sorted
+func (vm VRAMMap) Keys() []string {
+	keys := make([]string, 0, len(vm))
+	for key := range vm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ProdVRAM map[product]vram, the VRAM of each card of the product, vram is in bytes
+type ProdVRAM map[string]int64
+
+func (pv ProdVRAM) Validate() error {
+	return VRAMMap(pv).Validate()
+}
+
+// Add overwrites the VRAM of the products
+func (pv ProdVRAM) Add(pv1 ProdVRAM) {
+	for prod, vram := range pv1 {
+		pv[prod] = vram
+	}
+}
+
+func (pv ProdVRAM) Sub(pv1 ProdVRAM) {
+	for prod := range pv1 {
+		delete(pv, prod)
+	}
+}
+
+func (pv ProdVRAM) DeepCopy() ProdVRAM {
+	cp := make(ProdVRAM)
+	for k, v := range pv {
+		cp[k] = v
+	}
+	return cp
+}
+
+// MIGInfo describes a MIG instance
+type MIGInfo struct {
+	UUID string `json:"uuid" mapstructure:"uuid"`
+	// Parent is the address of the GPU which the instance is on
+	Parent  string `json:"parent" mapstructure:"parent"`
+	Profile string `json:"profile" mapstructure:"profile"`
+}
+
+// Slices returns the compute slices of the instance, e.g. 3 for 3g.40gb
+func (mi MIGInfo) Slices() int {
+	idx := strings.Index(mi.Profile, "g")
+	if idx <= 0 {
+		return 1
+	}
+	slices, err := strconv.Atoi(mi.Profile[:idx])
+	if err != nil || slices <= 0 {
+		return 1
+	}
+	return slices
+}
+
+// Fraction returns the proportion of the parent GPU taken by the instance
+func (mi MIGInfo) Fraction() float64 {
+	return float64(mi.Slices()) / float64(MaxMIGSlices)
+}
+
+// MIGMap map[uuid]MIGInfo, the MIG instances of a node
+type MIGMap map[string]MIGInfo
+
+func (mm MIGMap) Validate() error {
+	for uuid, info := range mm {
+		if strings.Trim(uuid, " ") == "" {
+			return errors.Wrapf(ErrInvalidMIG, "uuid is empty")
+		}
+		if info.UUID != "" && info.UUID != uuid {
+			return errors.Wrapf(ErrInvalidMIG, "uuid mismatch: <key: %s, uuid: %s>", uuid, info.UUID)
+		}
+		if strings.Trim(info.Parent, " ") == "" {
+			return errors.Wrapf(ErrInvalidMIG, "parent of %s is empty", uuid)
+		}
+		if strings.Trim(info.Profile, " ") == "" {
+			return errors.Wrapf(ErrInvalidMIG, "profile of %s is empty", uuid)
+		}
+	}
+	return nil
+}
+
+func (mm MIGMap) Add(mm1 MIGMap) {
+	for uuid, info := range mm1 {
+		mm[uuid] = info
+	}
+}
+
+func (mm MIGMap) Sub(mm1 MIGMap) {
+	for uuid := range mm1 {
+		delete(mm, uuid)
+	}
+}
+
+func (mm MIGMap) DeepCopy() MIGMap {
+	cp := make(MIGMap)
+	for k, v := range mm {
+		cp[k] = v
+	}
+	return cp
+}
+
+// Parents returns the addresses of the GPUs which are split into MIG instances
+func (mm MIGMap) Parents() map[string]struct{} {
+	parents := map[string]struct{}{}
+	for _, info := range mm {
+		parents[info.Parent] = struct{}{}
+	}
+	return parents
+}
+
+// ProfileCountMap counts the instances by profile
+func (mm MIGMap) ProfileCountMap() ProdCountMap {
+	pcm := ProdCountMap{}
+	for _, info := range mm {
+		pcm[info.Profile]++
+	}
+	return pcm
+}
+
+// ListByProfile returns the instances of the profile, ordered by parent and uuid
+func (mm MIGMap) ListByProfile(profile string) []MIGInfo {
+	infos := []MIGInfo{}
+	for uuid, info := range mm {
+		if info.Profile != profile {
+			continue
+		}
+		info.UUID = uuid
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Parent != infos[j].Parent {
+			return infos[i].Parent < infos[j].Parent
+		}
+		return infos[i].UUID < infos[j].UUID
+	})
+	return infos
+}
+
 // NUMA map[address]nodeID
 type NUMA map[string]string
+
+func (numa NUMA) Validate() error {
+	for addr, nodeID := range numa {
+		if strings.Trim(addr, " ") == "" {
+			return errors.Wrapf(ErrInvalidNUMA, "address is empty")
+		}
+		if strings.Trim(nodeID, " ") == "" {
+			return errors.Wrapf(ErrInvalidNUMA, "NUMA node of %s is empty", addr)
+		}
+	}
+	return nil
+}
+
+func (numa NUMA) Add(numa1 NUMA) {
+	for addr, nodeID := range numa1 {
+		numa[addr] = nodeID
+	}
+}
+
+func (numa NUMA) Sub(numa1 NUMA) {
+	for addr := range numa1 {
+		delete(numa, addr)
+	}
+}
+
+func (numa NUMA) DeepCopy() NUMA {
+	cp := make(NUMA)
+	for k, v := range numa {
+		cp[k] = v
+	}
+	return cp
+}
+
+// NodeIDOf returns the NUMA node of the GPUs,
+// empty string will be returned if the GPUs are not on the same NUMA node
+func (numa NUMA) NodeIDOf(gm GPUMap) string {
+	nodeID := ""
+	for addr := range gm {
+		id, ok := numa[addr]
+		if !ok || (nodeID != "" && id != nodeID) {
+			return ""
+		}
+		nodeID = id
+	}
+	return nodeID
+}
+
+// GPUInfo describes a GPU device
+type GPUInfo struct {
+	Address string `json:"address" mapstructure:"address"`
+	Index   int    `json:"index" mapstructure:"index"`
+	UUID    string `json:"uuid" mapstructure:"uuid"`
+	Product string `json:"product" mapstructure:"product"`
+	// VRAM in bytes, GPUs with VRAM can be shared by workloads
+	VRAM int64 `json:"vram" mapstructure:"vram"`
+}
+
+// GPUMap map[address]GPUInfo, the GPU device inventory of a node
+type GPUMap map[string]GPUInfo
+
+func (gm GPUMap) Validate() error {
+	for addr, info := range gm {
+		if strings.Trim(addr, " ") == "" {
+			return errors.Wrapf(ErrInvalidGPU, "address is empty")
+		}
+		if info.Address != "" && info.Address != addr {
+			return errors.Wrapf(ErrInvalidGPU, "address mismatch: <key: %s, address: %s>", addr, info.Address)
+		}
+		if strings.Trim(info.Product, " ") == "" {
+			return errors.Wrapf(ErrInvalidGPUProduct, "product of %s is empty", addr)
+		}
+		if info.VRAM < 0 {
+			return errors.Wrapf(ErrInvalidVRAM, "vram of %s is less than zero", addr)
+		}
+	}
+	return nil
+}
+
+func (gm GPUMap) Add(gm1 GPUMap) {
+	for addr, info := range gm1 {
+		gm[addr] = info
+	}
+}
+
+func (gm GPUMap) Sub(gm1 GPUMap) {
+	for addr := range gm1 {
+		delete(gm, addr)
+	}
+}
+
+func (gm GPUMap) DeepCopy() GPUMap {
+	cp := make(GPUMap)
+	for k, v := range gm {
+		cp[k] = v
+	}
+	return cp
+}
+
+// ProdCountMap counts the GPUs by product
+func (gm GPUMap) ProdCountMap() ProdCountMap {
+	pcm := ProdCountMap{}
+	for _, info := range gm {
+		pcm[info.Product]++
+	}
+	return pcm
+}
+
+// HasProd returns true if there is at least one GPU of the product
+func (gm GPUMap) HasProd(prod string) bool {
+	for _, info := range gm {
+		if info.Product == prod {
+			return true
+		}
+	}
+	return false
+}
+
+// ListByProd returns the GPUs of the product, ordered by index and address
+func (gm GPUMap) ListByProd(prod string) []GPUInfo {
+	infos := []GPUInfo{}
+	for addr, info := range gm {
+		if info.Product != prod {
+			continue
+		}
+		info.Address = addr
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Index != infos[j].Index {
+			return infos[i].Index < infos[j].Index
+		}
+		return infos[i].Address < infos[j].Address
+	})
+	return infos
+}
+
+// ExcludeMIG returns the GPUs which are not split into MIG instances
+func (gm GPUMap) ExcludeMIG(mm MIGMap) GPUMap {
+	parents := mm.Parents()
+	res := GPUMap{}
+	for addr, info := range gm {
+		if _, ok := parents[addr]; !ok {
+			res[addr] = info
+		}
+	}
+	return res
+}
+
+// VRAMOf returns the largest VRAM of the GPUs of the product
+func (gm GPUMap) VRAMOf(prod string) int64 {
+	var vram int64
+	for _, info := range gm {
+		if info.Product == prod && info.VRAM > vram {
+			vram = info.VRAM
+		}
+	}
+	return vram
+}
+
+// MinVRAMOf returns the smallest VRAM of the GPUs of the product, 0 if unknown
+func (gm GPUMap) MinVRAMOf(prod string) int64 {
+	var vram int64
+	for _, info := range gm {
+		if info.Product != prod || info.VRAM <= 0 {
+			continue
+		}
+		if vram == 0 || info.VRAM < vram {
+			vram = info.VRAM
+		}
+	}
+	return vram
+}
+
+// AddrCountMap map[address]count, the GPU devices held by workloads,
+// it's also used as map[uuid]count for the MIG instances
+type AddrCountMap map[string]int
+
+func (acm AddrCountMap) Validate() error {
+	for addr, count := range acm {
+		if count <= 0 {
+			return errors.Wrapf(ErrInvalidGPU, "count is less or equal to zero: <address: %s, count: %d>", addr, count)
+		}
+		if strings.Trim(addr, " ") == "" {
+			return errors.Wrapf(ErrInvalidGPU, "address is empty")
+		}
+	}
+	return nil
+}
+
+func (acm AddrCountMap) Add(acm1 AddrCountMap) {
+	for addr, count := range acm1 {
+		acm[addr] += count
+		if acm[addr] == 0 {
+			delete(acm, addr)
+		}
+	}
+}
+
+func (acm AddrCountMap) Sub(acm1 AddrCountMap) {
+	for addr, count := range acm1 {
+		acm[addr] -= count
+		if acm[addr] == 0 {
+			delete(acm, addr)
+		}
+	}
+}
+
+func (acm AddrCountMap) DeepCopy() AddrCountMap {
+	cp := make(AddrCountMap)
+	for k, v := range acm {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,122 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGPUMap(t *testing.T) {
+	gm := GPUMap{
+		"0000:02:00.0": {Index: 1, Product: "nvidia-3070"},
+		"0000:01:00.0": {Index: 0, Product: "nvidia-3070"},
+		"0000:81:00.0": {Index: 2, Product: "nvidia-3090"},
+	}
+	assert.Nil(t, gm.Validate())
+	assert.Equal(t, ProdCountMap{"nvidia-3070": 2, "nvidia-3090": 1}, gm.ProdCountMap())
+	assert.True(t, gm.HasProd("nvidia-3090"))
+	assert.False(t, gm.HasProd("nvidia-a100"))
+
+	infos := gm.ListByProd("nvidia-3070")
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "0000:01:00.0", infos[0].Address)
+	assert.Equal(t, "0000:02:00.0", infos[1].Address)
+
+	cp := gm.DeepCopy()
+	cp.Sub(GPUMap{"0000:81:00.0": {}})
+	assert.Len(t, cp, 2)
+	assert.Len(t, gm, 3)
+
+	// invalid
+	assert.Error(t, GPUMap{"0000:01:00.0": {Product: " "}}.Validate())
+	assert.Error(t, GPUMap{"0000:01:00.0": {Address: "0000:02:00.0", Product: "nvidia-3070"}}.Validate())
+}
+
+func TestAddrCountMap(t *testing.T) {
+	acm := AddrCountMap{"0000:01:00.0": 1}
+	acm.Add(AddrCountMap{"0000:02:00.0": 1})
+	assert.Len(t, acm, 2)
+	assert.Nil(t, acm.Validate())
+
+	acm.Sub(AddrCountMap{"0000:01:00.0": 1, "0000:02:00.0": 2})
+	assert.Equal(t, AddrCountMap{"0000:02:00.0": -1}, acm)
+	assert.Error(t, acm.Validate())
+}
+
+func TestNUMA(t *testing.T) {
+	numa := NUMA{
+		"0000:01:00.0": "0",
+		"0000:02:00.0": "0",
+		"0000:81:00.0": "1",
+	}
+	assert.Nil(t, numa.Validate())
+	assert.Equal(t, "0", numa.NodeIDOf(GPUMap{"0000:01:00.0": {}, "0000:02:00.0": {}}))
+	assert.Equal(t, "", numa.NodeIDOf(GPUMap{"0000:01:00.0": {}, "0000:81:00.0": {}}))
+	assert.Equal(t, "", numa.NodeIDOf(GPUMap{"0000:03:00.0": {}}))
+	assert.Equal(t, "", numa.NodeIDOf(GPUMap{}))
+
+	assert.Error(t, NUMA{"0000:01:00.0": ""}.Validate())
+}
+
+func TestVRAMMap(t *testing.T) {
+	vm := VRAMMap{"0000:01:00.0": 1024}
+	vm.Add(VRAMMap{"0000:01:00.0": 1024, "0000:02:00.0": 512})
+	assert.Equal(t, int64(2560), vm.Total())
+	assert.Nil(t, vm.Validate())
+
+	vm.Sub(VRAMMap{"0000:02:00.0": 512})
+	assert.Equal(t, VRAMMap{"0000:01:00.0": 2048}, vm)
+
+	vm.Sub(VRAMMap{"0000:01:00.0": 4096})
+	assert.Error(t, vm.Validate())
+	vm.RemoveLTE0()
+	assert.Len(t, vm, 0)
+}
+
+func TestMIGMap(t *testing.T) {
+	assert.Equal(t, 3, MIGInfo{Profile: "3g.40gb"}.Slices())
+	assert.Equal(t, 1, MIGInfo{Profile: "1g.10gb"}.Slices())
+	assert.Equal(t, 1, MIGInfo{Profile: "unknown"}.Slices())
+	assert.InDelta(t, 3.0/7, MIGInfo{Profile: "3g.40gb"}.Fraction(), 0.0001)
+
+	mm := MIGMap{
+		"MIG-2": {Parent: "0000:01:00.0", Profile: "3g.40gb"},
+		"MIG-1": {Parent: "0000:01:00.0", Profile: "3g.40gb"},
+		"MIG-3": {Parent: "0000:01:00.0", Profile: "1g.10gb"},
+	}
+	assert.Nil(t, mm.Validate())
+	assert.Equal(t, ProdCountMap{"3g.40gb": 2, "1g.10gb": 1}, mm.ProfileCountMap())
+	assert.Len(t, mm.Parents(), 1)
+	infos := mm.ListByProfile("3g.40gb")
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "MIG-1", infos[0].UUID)
+
+	gm := GPUMap{
+		"0000:01:00.0": {Product: "nvidia-a100"},
+		"0000:02:00.0": {Product: "nvidia-a100"},
+	}
+	assert.Equal(t, ProdCountMap{"nvidia-a100": 1}, gm.ExcludeMIG(mm).ProdCountMap())
+
+	assert.Error(t, MIGMap{"MIG-1": {Profile: "1g.10gb"}}.Validate())
+	assert.Error(t, MIGMap{"MIG-1": {Parent: "0000:01:00.0"}}.Validate())
+}
+
+func TestProdVRAM(t *testing.T) {
+	pv := ProdVRAM{"nvidia-a100": 40}
+	assert.Nil(t, pv.Validate())
+	assert.Error(t, ProdVRAM{"nvidia-a100": 0}.Validate())
+
+	pv.Add(ProdVRAM{"nvidia-a100": 80, "nvidia-3070": 8})
+	assert.Equal(t, ProdVRAM{"nvidia-a100": 80, "nvidia-3070": 8}, pv)
+	pv.Sub(ProdVRAM{"nvidia-a100": 80})
+	assert.Equal(t, ProdVRAM{"nvidia-3070": 8}, pv)
+
+	r := NewNodeResource(nil, GPUMap{
+		"0000:01:00.0": {Product: "nvidia-a100", VRAM: 80},
+		"0000:02:00.0": {Product: "nvidia-a100", VRAM: 40},
+	}, nil, nil, ProdVRAM{"nvidia-a100": 100, "nvidia-3070": 8})
+	// the VRAM of devices takes precedence, and all the cards have to satisfy it
+	assert.Equal(t, int64(40), r.VRAMOf("nvidia-a100"))
+	assert.Equal(t, int64(8), r.VRAMOf("nvidia-3070"))
+	assert.Equal(t, int64(0), r.VRAMOf("nvidia-3090"))
+}
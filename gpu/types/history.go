@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+const (
+	// OpSetCapacity is recorded by SetNodeResourceCapacity
+	OpSetCapacity = "set-capacity"
+	// OpSetUsage is recorded by SetNodeResourceUsage
+	OpSetUsage = "set-usage"
+	// OpFix is recorded by FixNodeResource when the usage is fixed
+	OpFix = "fix"
+)
+
+// HistoryRecord is a change of the capacity or the usage of node
+type HistoryRecord struct {
+	Time      time.Time     `json:"time"`
+	Operation string        `json:"operation"`
+	Delta     bool          `json:"delta"`
+	Incr      bool          `json:"incr"`
+	Before    *NodeResource `json:"before"`
+	After     *NodeResource `json:"after"`
+	// Reason is supplied by the caller, it may be empty
+	Reason string `json:"reason"`
+}
@@ -9,14 +9,50 @@ import (
 // NodeResource indicate node cpumem resource
 type NodeResource struct {
 	ProdCountMap ProdCountMap `json:"prod_count_map" mapstructure:"prod_count_map"`
+	// GPUMap is the device inventory, only used by capacity
+	GPUMap GPUMap `json:"gpu_map" mapstructure:"gpu_map"`
+	// AddrCountMap is the devices held by workloads, only used by usage
+	AddrCountMap AddrCountMap `json:"addr_count_map" mapstructure:"addr_count_map"`
+	// NUMA is the NUMA node of each device, only used by capacity
+	NUMA NUMA `json:"numa" mapstructure:"numa"`
+	// VRAMMap is the VRAM of the shared devices held by workloads, only used by usage
+	VRAMMap VRAMMap `json:"vram_map" mapstructure:"vram_map"`
+	// MIGMap is the MIG instances, only used by capacity,
+	// the parent GPUs of the instances can't be allocated as whole GPUs
+	MIGMap MIGMap `json:"mig_map" mapstructure:"mig_map"`
+	// MIGCountMap is the MIG instances held by workloads, only used by usage
+	MIGCountMap AddrCountMap `json:"mig_count_map" mapstructure:"mig_count_map"`
+	// ProdVRAM is the VRAM per card of each product, only used by capacity,
+	// the VRAM of the devices in GPUMap takes precedence
+	ProdVRAM ProdVRAM `json:"prod_vram" mapstructure:"prod_vram"`
 }
 
-func NewNodeResource(gm ProdCountMap) *NodeResource {
+func NewNodeResource(gm ProdCountMap, gpuMap GPUMap, numa NUMA, migMap MIGMap, prodVRAM ProdVRAM) *NodeResource {
 	r := &NodeResource{
 		ProdCountMap: gm,
+		GPUMap:       gpuMap,
+		AddrCountMap: AddrCountMap{},
+		NUMA:         numa,
+		VRAMMap:      VRAMMap{},
+		MIGMap:       migMap,
+		MIGCountMap:  AddrCountMap{},
+		ProdVRAM:     prodVRAM,
 	}
-	if r.ProdCountMap == nil {
-		r.ProdCountMap = ProdCountMap{}
+	if r.GPUMap == nil {
+		r.GPUMap = GPUMap{}
+	}
+	if r.NUMA == nil {
+		r.NUMA = NUMA{}
+	}
+	if r.MIGMap == nil {
+		r.MIGMap = MIGMap{}
+	}
+	if r.ProdVRAM == nil {
+		r.ProdVRAM = ProdVRAM{}
+	}
+	if len(r.ProdCountMap) == 0 {
+		// the counts can be derived from the device inventory
+		r.ProdCountMap = r.GPUMap.ExcludeMIG(r.MIGMap).ProdCountMap()
 	}
 	return r
 }
@@ -24,6 +60,13 @@ func NewNodeResource(gm ProdCountMap) *NodeResource {
 func (r *NodeResource) AsRawParams() resourcetypes.RawParams {
 	return resourcetypes.RawParams{
 		"prod_count_map": r.ProdCountMap,
+		"gpu_map":        r.GPUMap,
+		"addr_count_map": r.AddrCountMap,
+		"numa":           r.NUMA,
+		"vram_map":       r.VRAMMap,
+		"mig_map":        r.MIGMap,
+		"mig_count_map":  r.MIGCountMap,
+		"prod_vram":      r.ProdVRAM,
 	}
 }
 
@@ -33,13 +76,59 @@ func (r *NodeResource) Parse(rawParams resourcetypes.RawParams) error {
 }
 
 func (r *NodeResource) Validate() error {
-	return r.ProdCountMap.Validate()
+	if err := r.ProdCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.GPUMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.AddrCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.NUMA.Validate(); err != nil {
+		return err
+	}
+	if err := r.VRAMMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.MIGMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.MIGCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := r.ProdVRAM.Validate(); err != nil {
+		return err
+	}
+	for addr := range r.NUMA {
+		if _, ok := r.GPUMap[addr]; !ok {
+			return errors.Wrapf(ErrInvalidNUMA, "%s not in gpu map", addr)
+		}
+	}
+	for uuid, info := range r.MIGMap {
+		if _, ok := r.GPUMap[info.Parent]; !ok {
+			return errors.Wrapf(ErrInvalidMIG, "parent of %s not in gpu map", uuid)
+		}
+	}
+	for prod, count := range r.GPUMap.ExcludeMIG(r.MIGMap).ProdCountMap() {
+		if count > r.ProdCountMap[prod] {
+			return errors.Wrapf(ErrInvalidGPUMap, "%s: devices(%d) > count(%d)", prod, count, r.ProdCountMap[prod])
+		}
+	}
+	return nil
 }
 
 // DeepCopy .
 func (r *NodeResource) DeepCopy() *NodeResource {
 	res := &NodeResource{
 		ProdCountMap: r.ProdCountMap.DeepCopy(),
+		GPUMap:       r.GPUMap.DeepCopy(),
+		AddrCountMap: r.AddrCountMap.DeepCopy(),
+		NUMA:         r.NUMA.DeepCopy(),
+		VRAMMap:      r.VRAMMap.DeepCopy(),
+		MIGMap:       r.MIGMap.DeepCopy(),
+		MIGCountMap:  r.MIGCountMap.DeepCopy(),
+		ProdVRAM:     r.ProdVRAM.DeepCopy(),
 	}
 	return res
 }
@@ -47,11 +136,29 @@ func (r *NodeResource) DeepCopy() *NodeResource {
 // Add .
 func (r *NodeResource) Add(r1 *NodeResource) {
 	r.ProdCountMap.Add(r1.ProdCountMap)
+	r.GPUMap.Add(r1.GPUMap)
+	r.AddrCountMap.Add(r1.AddrCountMap)
+	r.NUMA.Add(r1.NUMA)
+	r.VRAMMap.Add(r1.VRAMMap)
+	r.MIGMap.Add(r1.MIGMap)
+	r.MIGCountMap.Add(r1.MIGCountMap)
+	r.ProdVRAM.Add(r1.ProdVRAM)
 }
 
 // Sub .
 func (r *NodeResource) Sub(r1 *NodeResource) {
 	r.ProdCountMap.Sub(r1.ProdCountMap)
+	r.GPUMap.Sub(r1.GPUMap)
+	r.AddrCountMap.Sub(r1.AddrCountMap)
+	r.NUMA.Sub(r1.NUMA)
+	r.VRAMMap.Sub(r1.VRAMMap)
+	r.MIGMap.Sub(r1.MIGMap)
+	r.MIGCountMap.Sub(r1.MIGCountMap)
+	r.ProdVRAM.Sub(r1.ProdVRAM)
+	// the removed devices are not on any NUMA node any more
+	for addr := range r1.GPUMap {
+		delete(r.NUMA, addr)
+	}
 }
 
 // Count
@@ -59,6 +166,27 @@ func (r *NodeResource) Count() int {
 	return r.ProdCountMap.TotalCount()
 }
 
+// Empty returns true if no GPU, VRAM or MIG instance is held
+func (r *NodeResource) Empty() bool {
+	if r.Count() > 0 || r.VRAMMap.Total() > 0 {
+		return false
+	}
+	for _, count := range r.MIGCountMap {
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VRAMOf returns the VRAM per card of the product, 0 if unknown
+func (r *NodeResource) VRAMOf(prod string) int64 {
+	if vram := r.GPUMap.MinVRAMOf(prod); vram > 0 {
+		return vram
+	}
+	return r.ProdVRAM[prod]
+}
+
 // NodeResourceInfo indicate cpumem capacity and usage
 type NodeResourceInfo struct {
 	Capacity *NodeResource `json:"capacity"`
@@ -69,10 +197,68 @@ func (n *NodeResourceInfo) CapCount() int {
 	return n.Capacity.Count()
 }
 
+// CapGPUs returns the number of GPUs, including the GPUs split into MIG instances
+func (n *NodeResourceInfo) CapGPUs() float64 {
+	return float64(n.CapCount() + len(n.Capacity.MIGMap.Parents()))
+}
+
 func (n *NodeResourceInfo) UsageCount() int {
 	return n.Usage.Count()
 }
 
+// UsageGPUs returns the number of GPUs in use,
+// the shared GPUs are counted by the proportion of VRAM in use,
+// and the MIG instances are counted by the proportion of compute slices.
+func (n *NodeResourceInfo) UsageGPUs() float64 {
+	usage := float64(n.UsageCount())
+	for addr, vram := range n.Usage.VRAMMap {
+		if info, ok := n.Capacity.GPUMap[addr]; ok && info.VRAM > 0 {
+			usage += float64(vram) / float64(info.VRAM)
+		}
+	}
+	for uuid := range n.Usage.MIGCountMap {
+		if info, ok := n.Capacity.MIGMap[uuid]; ok {
+			usage += info.Fraction()
+		}
+	}
+	return usage
+}
+
+// ProdCapGPUs returns the number of GPUs of each product, including the GPUs split into MIG instances
+func (n *NodeResourceInfo) ProdCapGPUs() map[string]float64 {
+	res := map[string]float64{}
+	for prod, count := range n.Capacity.ProdCountMap {
+		res[prod] += float64(count)
+	}
+	for addr := range n.Capacity.MIGMap.Parents() {
+		if info, ok := n.Capacity.GPUMap[addr]; ok {
+			res[info.Product]++
+		}
+	}
+	return res
+}
+
+// ProdUsageGPUs returns the number of GPUs in use of each product, counted the same as UsageGPUs
+func (n *NodeResourceInfo) ProdUsageGPUs() map[string]float64 {
+	res := map[string]float64{}
+	for prod, count := range n.Usage.ProdCountMap {
+		if count > 0 {
+			res[prod] += float64(count)
+		}
+	}
+	for addr, vram := range n.Usage.VRAMMap {
+		if info, ok := n.Capacity.GPUMap[addr]; ok && info.VRAM > 0 {
+			res[info.Product] += float64(vram) / float64(info.VRAM)
+		}
+	}
+	for uuid := range n.Usage.MIGCountMap {
+		if info, ok := n.Capacity.MIGMap[uuid]; ok {
+			res[n.Capacity.GPUMap[info.Parent].Product] += info.Fraction()
+		}
+	}
+	return res
+}
+
 // DeepCopy .
 func (n *NodeResourceInfo) DeepCopy() *NodeResourceInfo {
 	return &NodeResourceInfo{
@@ -88,12 +274,73 @@ func (n *NodeResourceInfo) Validate() error {
 	if err := n.Usage.Validate(); err != nil {
 		return errors.Wrap(err, "invalid usage")
 	}
+	for addr, count := range n.Usage.AddrCountMap {
+		if _, ok := n.Capacity.GPUMap[addr]; !ok {
+			return errors.Wrapf(ErrInvalidGPU, "%s not in capacity", addr)
+		}
+		if count > 1 {
+			return errors.Wrapf(ErrInvalidGPU, "%s is held by %d workloads", addr, count)
+		}
+	}
+	for addr, vram := range n.Usage.VRAMMap {
+		info, ok := n.Capacity.GPUMap[addr]
+		if !ok {
+			return errors.Wrapf(ErrInvalidVRAM, "%s not in capacity", addr)
+		}
+		if vram > info.VRAM {
+			return errors.Wrapf(ErrInvalidVRAM, "%s: used(%d) > vram(%d)", addr, vram, info.VRAM)
+		}
+		if _, ok := n.Usage.AddrCountMap[addr]; ok {
+			return errors.Wrapf(ErrInvalidVRAM, "%s is both held and shared", addr)
+		}
+	}
+	parents := n.Capacity.MIGMap.Parents()
+	for addr := range parents {
+		if _, ok := n.Usage.AddrCountMap[addr]; ok {
+			return errors.Wrapf(ErrInvalidMIG, "%s is split into MIG instances but held by workload", addr)
+		}
+		if _, ok := n.Usage.VRAMMap[addr]; ok {
+			return errors.Wrapf(ErrInvalidMIG, "%s is split into MIG instances but shared by workloads", addr)
+		}
+	}
+	for uuid, count := range n.Usage.MIGCountMap {
+		if _, ok := n.Capacity.MIGMap[uuid]; !ok {
+			return errors.Wrapf(ErrInvalidMIG, "%s not in capacity", uuid)
+		}
+		if count > 1 {
+			return errors.Wrapf(ErrInvalidMIG, "%s is held by %d workloads", uuid, count)
+		}
+	}
 	return nil
 }
 
+// GetAvailableResource returns the remaining resource,
+// the GPUMap of which only contains the devices not used by any workload,
+// the VRAMMap of which contains the free VRAM of the devices can be shared,
+// and the MIGMap of which contains the MIG instances not held by any workload.
 func (n *NodeResourceInfo) GetAvailableResource() *NodeResource {
 	availableResource := n.Capacity.DeepCopy()
-	availableResource.Sub(n.Usage)
+	availableResource.ProdCountMap.Sub(n.Usage.ProdCountMap)
+	availableResource.GPUMap = availableResource.GPUMap.ExcludeMIG(n.Capacity.MIGMap)
+	for addr := range n.Usage.AddrCountMap {
+		delete(availableResource.GPUMap, addr)
+	}
+	for addr := range n.Usage.VRAMMap {
+		delete(availableResource.GPUMap, addr)
+	}
+	for uuid := range n.Usage.MIGCountMap {
+		delete(availableResource.MIGMap, uuid)
+	}
+
+	availableResource.VRAMMap = VRAMMap{}
+	for addr, info := range n.Capacity.GPUMap.ExcludeMIG(n.Capacity.MIGMap) {
+		if _, ok := n.Usage.AddrCountMap[addr]; ok || info.VRAM <= 0 {
+			continue
+		}
+		if free := info.VRAM - n.Usage.VRAMMap[addr]; free > 0 {
+			availableResource.VRAMMap[addr] = free
+		}
+	}
 
 	return availableResource
 }
@@ -101,20 +348,54 @@ func (n *NodeResourceInfo) GetAvailableResource() *NodeResource {
 // NodeResourceRequest includes all possible fields passed by eru-core for editing node, it not parsed!
 type NodeResourceRequest struct {
 	ProdCountMap ProdCountMap `json:"prod_count_map" mapstructure:"prod_count_map"`
+	GPUMap       GPUMap       `json:"gpu_map" mapstructure:"gpu_map"`
+	NUMA         NUMA         `json:"numa" mapstructure:"numa"`
+	MIGMap       MIGMap       `json:"mig_map" mapstructure:"mig_map"`
+	ProdVRAM     ProdVRAM     `json:"prod_vram" mapstructure:"prod_vram"`
+	// Labels are kept aside from the resource, only used by AddNode
+	Labels NodeLabels `json:"labels" mapstructure:"labels"`
 }
 
 func (n *NodeResourceRequest) Parse(rawParams resourcetypes.RawParams) error {
 	if err := mapstructure.Decode(rawParams, n); err != nil {
 		return err
 	}
+	if n.GPUMap == nil {
+		n.GPUMap = GPUMap{}
+	}
+	if n.NUMA == nil {
+		n.NUMA = NUMA{}
+	}
+	if n.MIGMap == nil {
+		n.MIGMap = MIGMap{}
+	}
+	if n.ProdVRAM == nil {
+		n.ProdVRAM = ProdVRAM{}
+	}
 	if n.ProdCountMap == nil {
-		n.ProdCountMap = ProdCountMap{}
+		// the counts can be derived from the device inventory
+		n.ProdCountMap = n.GPUMap.ExcludeMIG(n.MIGMap).ProdCountMap()
 	}
 	return nil
 }
 
 func (n *NodeResourceRequest) Validate() error {
-	return n.ProdCountMap.Validate()
+	if err := n.ProdCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := n.GPUMap.Validate(); err != nil {
+		return err
+	}
+	if err := n.MIGMap.Validate(); err != nil {
+		return err
+	}
+	if err := n.ProdVRAM.Validate(); err != nil {
+		return err
+	}
+	if err := n.Labels.Validate(); err != nil {
+		return err
+	}
+	return n.NUMA.Validate()
 }
 
 func (n *NodeResourceRequest) Count() int {
@@ -126,7 +407,19 @@ func (n *NodeResourceRequest) LoadFromOrigin(nodeResource *NodeResource, resourc
 	if n == nil {
 		return
 	}
-	if !resourceRequest.IsSet("prod_count_map") {
+	if !resourceRequest.IsSet("prod_count_map") && !resourceRequest.IsSet("gpu_map") && !resourceRequest.IsSet("mig_map") {
 		n.ProdCountMap = nodeResource.ProdCountMap
 	}
+	if !resourceRequest.IsSet("gpu_map") {
+		n.GPUMap = nodeResource.GPUMap
+	}
+	if !resourceRequest.IsSet("numa") {
+		n.NUMA = nodeResource.NUMA
+	}
+	if !resourceRequest.IsSet("mig_map") {
+		n.MIGMap = nodeResource.MIGMap
+	}
+	if !resourceRequest.IsSet("prod_vram") {
+		n.ProdVRAM = nodeResource.ProdVRAM
+	}
 }
@@ -68,3 +68,33 @@ func TestJsonLoadNodeReqResp(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, res.Count(), 6)
 }
+
+func TestNodeResourceInfoWithGPUMap(t *testing.T) {
+	capacity := NewNodeResource(nil, GPUMap{
+		"0000:01:00.0": {Index: 0, Product: "nvidia-3070"},
+		"0000:02:00.0": {Index: 1, Product: "nvidia-3070"},
+	}, nil, nil, nil)
+	assert.Equal(t, 2, capacity.Count())
+
+	info := &NodeResourceInfo{
+		Capacity: capacity,
+		Usage: &NodeResource{
+			ProdCountMap: ProdCountMap{"nvidia-3070": 1},
+			AddrCountMap: AddrCountMap{"0000:01:00.0": 1},
+		},
+	}
+	assert.Nil(t, info.Validate())
+	available := info.GetAvailableResource()
+	assert.Equal(t, 1, available.Count())
+	assert.Len(t, available.GPUMap, 1)
+	_, ok := available.GPUMap["0000:02:00.0"]
+	assert.True(t, ok)
+
+	// device which is not in capacity
+	info.Usage.AddrCountMap["0000:03:00.0"] = 1
+	assert.Error(t, info.Validate())
+
+	// more devices than count
+	capacity.ProdCountMap["nvidia-3070"] = 1
+	assert.Error(t, capacity.Validate())
+}
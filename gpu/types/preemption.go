@@ -0,0 +1,48 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreemptionVictim is a workload to be evicted, it's identified by the alloc ID in its workload resource
+type PreemptionVictim struct {
+	AllocID      string       `json:"alloc_id"`
+	Tenant       string       `json:"tenant"`
+	Priority     int          `json:"priority"`
+	ProdCountMap ProdCountMap `json:"prod_count_map"`
+}
+
+// PreemptionPlan is the workloads with lower priority to be evicted from a node, so the request can fit,
+// the plugin doesn't evict them, eru-core or the operator carries it out.
+type PreemptionPlan struct {
+	Nodename string `json:"nodename"`
+	// Priority is the priority of the request
+	Priority int                 `json:"priority"`
+	Victims  []*PreemptionVictim `json:"victims"`
+	// Freed is the GPUs released by the victims
+	Freed ProdCountMap `json:"freed"`
+}
+
+func (p *PreemptionPlan) String() string {
+	victims := make([]string, 0, len(p.Victims))
+	for _, victim := range p.Victims {
+		victims = append(victims, fmt.Sprintf("%s(priority %d)", victim.AllocID, victim.Priority))
+	}
+	return fmt.Sprintf("node %s: evict %s", p.Nodename, strings.Join(victims, ", "))
+}
+
+// PreemptionRequiredError is InsufficientResourceError with the plan to make room for the request
+type PreemptionRequiredError struct {
+	*InsufficientResourceError
+	Plan *PreemptionPlan
+}
+
+func (e *PreemptionRequiredError) Error() string {
+	return fmt.Sprintf("%s, preemption plan: %s", e.InsufficientResourceError.Error(), e.Plan.String())
+}
+
+// Unwrap makes errors.As(err, *InsufficientResourceError) work
+func (e *PreemptionRequiredError) Unwrap() error {
+	return e.InsufficientResourceError
+}
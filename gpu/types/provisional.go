@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// ProvisionalReservation holds the resource of a workload planned by CalculateDeploy,
+// it's confirmed when eru-core sets the usage of the workload, or released when it expires.
+type ProvisionalReservation struct {
+	Resource  *WorkloadResource `json:"resource"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Expired returns true if the reservation is not held any more at now
+func (r *ProvisionalReservation) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
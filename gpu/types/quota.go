@@ -0,0 +1,47 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Quota limits the GPUs a tenant may hold cluster-wide, e.g. team-vision may hold at most 16 nvidia-a100,
+// the products not in Limit are not limited.
+type Quota struct {
+	Tenant string       `json:"tenant"`
+	Limit  ProdCountMap `json:"limit"`
+	// Usage is the GPUs held by the workloads of tenant
+	Usage ProdCountMap `json:"usage"`
+}
+
+// Validate .
+func (q *Quota) Validate() error {
+	if strings.TrimSpace(q.Tenant) == "" {
+		return errors.Wrap(ErrInvalidQuota, "tenant is empty")
+	}
+	if err := q.Limit.ValidateProd(); err != nil {
+		return err
+	}
+	for prod, count := range q.Limit {
+		// 0 forbids the tenant to use the product
+		if count < 0 {
+			return errors.Wrapf(ErrInvalidGPUMap, "%s: limit is negative", prod)
+		}
+	}
+	return nil
+}
+
+// Check returns ErrQuotaExceeded if the tenant would hold more GPUs than the limit after incr is added
+func (q *Quota) Check(incr ProdCountMap) error {
+	for prod, count := range incr {
+		limit, ok := q.Limit[prod]
+		if !ok || count <= 0 {
+			continue
+		}
+		if q.Usage[prod]+count > limit {
+			return errors.Wrapf(ErrQuotaExceeded, "tenant %s holds %d %s, requests %d more, limit %d", q.Tenant, q.Usage[prod], prod, count, limit)
+		}
+	}
+	return nil
+}
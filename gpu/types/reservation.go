@@ -0,0 +1,76 @@
+package types
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Reservation sets aside GPUs of a product on nodes for a tenant during [Start, End),
+// the GPUs are unavailable to the requests which don't carry the ID of the reservation.
+type Reservation struct {
+	ID      string `json:"id"`
+	Tenant  string `json:"tenant"`
+	Product string `json:"product"`
+	// NodeCountMap is the number of GPUs reserved on each node
+	NodeCountMap map[string]int `json:"node_count_map"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+}
+
+// Active returns true if the GPUs are reserved at now
+func (r *Reservation) Active(now time.Time) bool {
+	return !now.Before(r.Start) && now.Before(r.End)
+}
+
+// Expired returns true if the reservation has ended at now
+func (r *Reservation) Expired(now time.Time) bool {
+	return !now.Before(r.End)
+}
+
+// Overlaps returns true if the time windows of the reservations overlap
+func (r *Reservation) Overlaps(start, end time.Time) bool {
+	return r.Start.Before(end) && start.Before(r.End)
+}
+
+// Count returns the number of GPUs reserved on all the nodes
+func (r *Reservation) Count() int {
+	count := 0
+	for _, c := range r.NodeCountMap {
+		count += c
+	}
+	return count
+}
+
+// ReservationRequest creates a reservation, Count GPUs are reserved on each of Nodes,
+// or Count GPUs in total across the nodes of Pool, which are spread over them by the plugin.
+type ReservationRequest struct {
+	Tenant  string    `json:"tenant"`
+	Product string    `json:"product"`
+	Nodes   []string  `json:"nodes"`
+	Pool    []string  `json:"pool"`
+	Count   int       `json:"count"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// Validate .
+func (r *ReservationRequest) Validate() error {
+	if strings.TrimSpace(r.Tenant) == "" {
+		return errors.Wrap(ErrInvalidReservation, "tenant is empty")
+	}
+	if strings.TrimSpace(r.Product) == "" {
+		return errors.Wrap(ErrInvalidReservation, "product is empty")
+	}
+	if (len(r.Nodes) == 0) == (len(r.Pool) == 0) {
+		return errors.Wrap(ErrInvalidReservation, "either nodes or pool is required")
+	}
+	if r.Count <= 0 {
+		return errors.Wrapf(ErrInvalidReservation, "count %d is not positive", r.Count)
+	}
+	if !r.Start.Before(r.End) {
+		return errors.Wrapf(ErrInvalidReservation, "start %s is not before end %s", r.Start, r.End)
+	}
+	return nil
+}
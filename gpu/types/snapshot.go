@@ -0,0 +1,90 @@
+package types
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// SnapshotVersion is the version of snapshot written by this plugin,
+// version 2 adds the records of allocations, the labels, the reservations and the quotas,
+// version 1 is still accepted as nodes without records, the others are kept as they are.
+const SnapshotVersion = 2
+
+const (
+	// ImportValidate only validates the snapshot, nothing is written
+	ImportValidate = "validate"
+	// ImportMerge writes the nodes in snapshot, the other nodes are kept
+	ImportMerge = "merge"
+	// ImportReplace writes the nodes in snapshot and removes the other nodes
+	ImportReplace = "replace"
+)
+
+// Snapshot is the resource info and the records of allocations of all nodes,
+// with the labels of nodes, the reservations and the quotas of tenants.
+type Snapshot struct {
+	Version      int                            `json:"version"`
+	Time         time.Time                      `json:"time"`
+	Nodes        map[string]*NodeResourceInfo   `json:"nodes"`
+	Allocations  map[string][]*WorkloadResource `json:"allocations,omitempty"`
+	Labels       map[string]NodeLabels          `json:"labels,omitempty"`
+	Reservations map[string]*Reservation        `json:"reservations,omitempty"`
+	Quotas       map[string]ProdCountMap        `json:"quotas,omitempty"`
+	// Corrupt is the nodes left out by export since their resource info can't be decoded or is invalid
+	Corrupt []*NodeDiagnostic `json:"corrupt,omitempty"`
+}
+
+// ImportResult is the nodes imported from snapshot and removed by replace,
+// if the import fails halfway, it's the nodes already written.
+type ImportResult struct {
+	Imported []string `json:"imported"`
+	Removed  []string `json:"removed"`
+}
+
+// Validate validates every node in snapshot
+func (s *Snapshot) Validate() error {
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return errors.Wrapf(ErrInvalidSnapshot, "unsupported version %d", s.Version)
+	}
+	for nodename, nodeResourceInfo := range s.Nodes {
+		if nodename == "" || strings.Contains(nodename, "/") {
+			return errors.Wrapf(ErrInvalidSnapshot, "invalid nodename %q", nodename)
+		}
+		if nodeResourceInfo == nil || nodeResourceInfo.Capacity == nil || nodeResourceInfo.Usage == nil {
+			return errors.Wrapf(ErrInvalidSnapshot, "node %s: capacity and usage are required", nodename)
+		}
+		if err := nodeResourceInfo.DeepCopy().Validate(); err != nil {
+			return errors.Wrapf(err, "node %s", nodename)
+		}
+	}
+	for nodename, allocations := range s.Allocations {
+		if _, ok := s.Nodes[nodename]; !ok {
+			return errors.Wrapf(ErrInvalidSnapshot, "allocations of node %s which is not in snapshot", nodename)
+		}
+		for _, allocation := range allocations {
+			if allocation == nil || allocation.AllocID == "" || strings.Contains(allocation.AllocID, "/") {
+				return errors.Wrapf(ErrInvalidSnapshot, "node %s: invalid allocation", nodename)
+			}
+		}
+	}
+	for nodename, labels := range s.Labels {
+		if _, ok := s.Nodes[nodename]; !ok {
+			return errors.Wrapf(ErrInvalidSnapshot, "labels of node %s which is not in snapshot", nodename)
+		}
+		if err := labels.Validate(); err != nil {
+			return errors.Wrapf(err, "node %s", nodename)
+		}
+	}
+	for id, reservation := range s.Reservations {
+		if reservation == nil || reservation.ID != id || reservation.Tenant == "" || reservation.Product == "" || !reservation.Start.Before(reservation.End) {
+			return errors.Wrapf(ErrInvalidSnapshot, "invalid reservation %s", id)
+		}
+	}
+	for tenant, limit := range s.Quotas {
+		if err := (&Quota{Tenant: tenant, Limit: limit}).Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
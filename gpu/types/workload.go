@@ -1,6 +1,9 @@
 package types
 
 import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
 	"github.com/mitchellh/mapstructure"
 	resourcetypes "github.com/projecteru2/core/resource/types"
 )
@@ -8,15 +11,59 @@ import (
 // WorkloadResource indicate GPU workload resource
 type WorkloadResource struct {
 	ProdCountMap ProdCountMap `json:"prod_count_map" mapstructure:"prod_count_map"`
+	AddrCountMap AddrCountMap `json:"addr_count_map" mapstructure:"addr_count_map"`
+	NUMANode     string       `json:"numa_node" mapstructure:"numa_node"`
+	// ProdVRAMMap is the VRAM slices held by the workload, VRAMMap is the devices the slices are on
+	ProdVRAMMap VRAMMap `json:"prod_vram_map" mapstructure:"prod_vram_map"`
+	VRAMMap     VRAMMap `json:"vram_map" mapstructure:"vram_map"`
+	// ProfileCountMap is the MIG profiles held by the workload, MIGCountMap is the concrete instances
+	ProfileCountMap ProdCountMap `json:"profile_count_map" mapstructure:"profile_count_map"`
+	MIGCountMap     AddrCountMap `json:"mig_count_map" mapstructure:"mig_count_map"`
+	// Alternative is the alternative chosen from the request, nil if the request has no alternatives
+	Alternative ProdCountMap `json:"alternative" mapstructure:"alternative"`
+	// AllocID identifies the allocation of the workload in the records of plugin, it's kept across realloc
+	AllocID string `json:"alloc_id" mapstructure:"alloc_id"`
+	// ReservationID is the reservation the workload is deployed by, empty if it's not
+	ReservationID string `json:"reservation_id" mapstructure:"reservation_id"`
+	// Tenant is the tenant the workload belongs to, the GPUs held are counted against its quota
+	Tenant string `json:"tenant" mapstructure:"tenant"`
+	// Priority decides which workloads can be preempted by the others, higher is more important
+	Priority int `json:"priority" mapstructure:"priority"`
 }
 
 func (w *WorkloadResource) AsRawParams() resourcetypes.RawParams {
 	return resourcetypes.RawParams{
-		"prod_count_map": w.ProdCountMap,
+		"prod_count_map":    w.ProdCountMap,
+		"addr_count_map":    w.AddrCountMap,
+		"numa_node":         w.NUMANode,
+		"prod_vram_map":     w.ProdVRAMMap,
+		"vram_map":          w.VRAMMap,
+		"profile_count_map": w.ProfileCountMap,
+		"mig_count_map":     w.MIGCountMap,
+		"alternative":       w.Alternative,
+		"alloc_id":          w.AllocID,
+		"reservation_id":    w.ReservationID,
+		"tenant":            w.Tenant,
+		"priority":          w.Priority,
 	}
 }
 func (w *WorkloadResource) Validate() error {
-	return w.ProdCountMap.Validate()
+	if err := w.ProdCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := w.AddrCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := w.ProdVRAMMap.Validate(); err != nil {
+		return err
+	}
+	if err := w.VRAMMap.Validate(); err != nil {
+		return err
+	}
+	if err := w.ProfileCountMap.Validate(); err != nil {
+		return err
+	}
+	return w.MIGCountMap.Validate()
 }
 
 // ParseFromRawParams .
@@ -27,7 +74,20 @@ func (w *WorkloadResource) Parse(rawParams resourcetypes.RawParams) error {
 // DeepCopy .
 func (w *WorkloadResource) DeepCopy() *WorkloadResource {
 	res := &WorkloadResource{
-		ProdCountMap: w.ProdCountMap.DeepCopy(),
+		ProdCountMap:    w.ProdCountMap.DeepCopy(),
+		AddrCountMap:    w.AddrCountMap.DeepCopy(),
+		NUMANode:        w.NUMANode,
+		ProdVRAMMap:     w.ProdVRAMMap.DeepCopy(),
+		VRAMMap:         w.VRAMMap.DeepCopy(),
+		ProfileCountMap: w.ProfileCountMap.DeepCopy(),
+		MIGCountMap:     w.MIGCountMap.DeepCopy(),
+		AllocID:         w.AllocID,
+		ReservationID:   w.ReservationID,
+		Tenant:          w.Tenant,
+		Priority:        w.Priority,
+	}
+	if w.Alternative != nil {
+		res.Alternative = w.Alternative.DeepCopy()
 	}
 	return res
 }
@@ -35,11 +95,21 @@ func (w *WorkloadResource) DeepCopy() *WorkloadResource {
 // Add .
 func (w *WorkloadResource) Add(w1 *WorkloadResource) {
 	w.ProdCountMap.Add(w1.ProdCountMap)
+	w.AddrCountMap.Add(w1.AddrCountMap)
+	w.ProdVRAMMap.Add(w1.ProdVRAMMap)
+	w.VRAMMap.Add(w1.VRAMMap)
+	w.ProfileCountMap.Add(w1.ProfileCountMap)
+	w.MIGCountMap.Add(w1.MIGCountMap)
 }
 
 // Sub .
 func (w *WorkloadResource) Sub(w1 *WorkloadResource) {
 	w.ProdCountMap.Sub(w1.ProdCountMap)
+	w.AddrCountMap.Sub(w1.AddrCountMap)
+	w.ProdVRAMMap.Sub(w1.ProdVRAMMap)
+	w.VRAMMap.Sub(w1.VRAMMap)
+	w.ProfileCountMap.Sub(w1.ProfileCountMap)
+	w.MIGCountMap.Sub(w1.MIGCountMap)
 }
 
 // Count
@@ -47,22 +117,148 @@ func (w *WorkloadResource) Count() int {
 	return w.ProdCountMap.TotalCount()
 }
 
+// Empty returns true if the workload holds nothing
+func (w *WorkloadResource) Empty() bool {
+	return len(w.ProdCountMap) == 0 && len(w.AddrCountMap) == 0 &&
+		len(w.ProdVRAMMap) == 0 && len(w.VRAMMap) == 0 &&
+		len(w.ProfileCountMap) == 0 && len(w.MIGCountMap) == 0
+}
+
 // WorkloadResourceRaw includes all possible fields passed by eru-core for editing workload
 // for request calculation
 type WorkloadResourceRequest struct {
 	ProdCountMap ProdCountMap `json:"prod_count_map" mapstructure:"prod_count_map"`
+	// ProdVRAMMap requests a slice of VRAM on a shared GPU for each product
+	ProdVRAMMap VRAMMap `json:"prod_vram_map" mapstructure:"prod_vram_map"`
+	// ProfileCountMap requests MIG instances by profile, e.g. 1g.10gb
+	ProfileCountMap ProdCountMap `json:"profile_count_map" mapstructure:"profile_count_map"`
+	// MinVRAMCount requests GPUs of any product whose VRAM per card is at least MinVRAM,
+	// all of them will be of the same product
+	MinVRAM      int64 `json:"min_vram" mapstructure:"min_vram"`
+	MinVRAMCount int   `json:"min_vram_count" mapstructure:"min_vram_count"`
+	// Alternatives are tried in order instead of ProdCountMap, the first one which fits will be chosen
+	Alternatives []ProdCountMap `json:"alternatives" mapstructure:"alternatives"`
+	// ReservationID allows the request to use the GPUs set aside by the reservation
+	ReservationID string `json:"reservation_id" mapstructure:"reservation_id"`
+	// Tenant is checked against its quota
+	Tenant string `json:"tenant" mapstructure:"tenant"`
+	// Priority is kept by the workloads, Preempt asks for a preemption plan
+	// of the workloads with lower priority if the request can't fit.
+	// 0 means keeping the priority of workload in realloc, so it can't be lowered back to 0 there.
+	Priority int  `json:"priority" mapstructure:"priority"`
+	Preempt  bool `json:"preempt" mapstructure:"preempt"`
 }
 
 // Validate .
 func (w *WorkloadResourceRequest) ValidateProd() error {
 	// empty ProdCountMap means this request doesn't need GPU
 	// in order to support realloc, the count can be negative, so only validate prod here
-	return w.ProdCountMap.ValidateProd()
+	if err := w.ProdCountMap.ValidateProd(); err != nil {
+		return err
+	}
+	for prod := range w.ProdVRAMMap {
+		if strings.Trim(prod, " ") == "" {
+			return errors.Wrapf(ErrInvalidGPUProduct, "product is empty")
+		}
+	}
+	if err := w.ProfileCountMap.ValidateProd(); err != nil {
+		return err
+	}
+	for _, alternative := range w.Alternatives {
+		if err := alternative.ValidateProd(); err != nil {
+			return err
+		}
+	}
+	if err := w.validateConstraints(); err != nil {
+		return err
+	}
+	if err := w.validateAlternatives(); err != nil {
+		return err
+	}
+	if err := w.validatePriority(); err != nil {
+		return err
+	}
+	return w.validateMinVRAM()
 }
 
 func (w *WorkloadResourceRequest) Validate() error {
 	// empty ProdCountMap means this request doesn't need GPU
-	return w.ProdCountMap.Validate()
+	if err := w.ProdCountMap.Validate(); err != nil {
+		return err
+	}
+	if err := w.ProdVRAMMap.Validate(); err != nil {
+		return err
+	}
+	for prod := range w.ProdVRAMMap {
+		if _, ok := w.ProdCountMap[prod]; ok {
+			return errors.Wrapf(ErrInvalidVRAM, "%s can't be requested by both count and vram", prod)
+		}
+	}
+	if err := w.ProfileCountMap.Validate(); err != nil {
+		return err
+	}
+	for _, alternative := range w.Alternatives {
+		if err := alternative.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := w.validateConstraints(); err != nil {
+		return err
+	}
+	if err := w.validateAlternatives(); err != nil {
+		return err
+	}
+	if err := w.validatePriority(); err != nil {
+		return err
+	}
+	return w.validateMinVRAM()
+}
+
+// validateConstraints validates the products requested by constraints
+func (w *WorkloadResourceRequest) validateConstraints() error {
+	for _, pcm := range append([]ProdCountMap{w.ProdCountMap}, w.Alternatives...) {
+		for prod := range pcm {
+			if !IsConstraint(prod) {
+				continue
+			}
+			if _, err := ParseConstraints(prod); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WorkloadResourceRequest) validateAlternatives() error {
+	if len(w.Alternatives) == 0 {
+		return nil
+	}
+	if len(w.ProdCountMap) > 0 {
+		return errors.Wrapf(ErrInvalidGPUMap, "prod_count_map and alternatives can't be requested together")
+	}
+	for i, alternative := range w.Alternatives {
+		if len(alternative) == 0 {
+			return errors.Wrapf(ErrInvalidGPUMap, "alternative %d is empty", i)
+		}
+	}
+	return nil
+}
+
+func (w *WorkloadResourceRequest) validatePriority() error {
+	if w.Priority < 0 {
+		return errors.Wrapf(ErrInvalidPriority, "priority(%d) can't be negative", w.Priority)
+	}
+	return nil
+}
+
+func (w *WorkloadResourceRequest) validateMinVRAM() error {
+	if w.MinVRAM < 0 || w.MinVRAMCount < 0 {
+		return errors.Wrapf(ErrInvalidVRAM, "min vram(%d) and count(%d) can't be negative", w.MinVRAM, w.MinVRAMCount)
+	}
+	if w.MinVRAMCount > 0 && w.MinVRAM == 0 {
+		return errors.Wrapf(ErrInvalidVRAM, "min vram is required")
+	}
+	return nil
 }
 
 // Parse .
@@ -79,14 +275,65 @@ func (w *WorkloadResourceRequest) MergeFromResource(r *WorkloadResource) {
 		}
 	}
 	w.ProdCountMap = newMap
+
+	prodVRAMMap := w.ProdVRAMMap.DeepCopy()
+	prodVRAMMap.Add(r.ProdVRAMMap)
+	prodVRAMMap.RemoveLTE0()
+	w.ProdVRAMMap = prodVRAMMap
+
+	profileCountMap := w.ProfileCountMap.DeepCopy()
+	profileCountMap.Add(r.ProfileCountMap)
+	profileCountMap.RemoveLTE0()
+	w.ProfileCountMap = profileCountMap
 }
 
 func (w *WorkloadResourceRequest) DeepCopy() *WorkloadResourceRequest {
 	return &WorkloadResourceRequest{
-		ProdCountMap: w.ProdCountMap.DeepCopy(),
+		ProdCountMap:    w.ProdCountMap.DeepCopy(),
+		ProdVRAMMap:     w.ProdVRAMMap.DeepCopy(),
+		ProfileCountMap: w.ProfileCountMap.DeepCopy(),
+		MinVRAM:         w.MinVRAM,
+		MinVRAMCount:    w.MinVRAMCount,
+		Alternatives:    w.deepCopyAlternatives(),
+		ReservationID:   w.ReservationID,
+		Tenant:          w.Tenant,
+		Priority:        w.Priority,
+		Preempt:         w.Preempt,
+	}
+}
+
+func (w *WorkloadResourceRequest) deepCopyAlternatives() []ProdCountMap {
+	if w.Alternatives == nil {
+		return nil
+	}
+	res := make([]ProdCountMap, 0, len(w.Alternatives))
+	for _, alternative := range w.Alternatives {
+		res = append(res, alternative.DeepCopy())
+	}
+	return res
+}
+
+// Expand returns a request for each alternative in order, the ProdCountMap of which is the alternative,
+// the request itself will be returned if it has no alternatives.
+func (w *WorkloadResourceRequest) Expand() []*WorkloadResourceRequest {
+	if len(w.Alternatives) == 0 {
+		return []*WorkloadResourceRequest{w}
+	}
+	res := make([]*WorkloadResourceRequest, 0, len(w.Alternatives))
+	for _, alternative := range w.Alternatives {
+		req := w.DeepCopy()
+		req.ProdCountMap = alternative.DeepCopy()
+		req.Alternatives = nil
+		res = append(res, req)
 	}
+	return res
 }
 
 func (w *WorkloadResourceRequest) Count() int {
 	return w.ProdCountMap.TotalCount()
 }
+
+// Empty returns true if the request doesn't need GPU
+func (w *WorkloadResourceRequest) Empty() bool {
+	return w.Count() == 0 && len(w.ProdVRAMMap) == 0 && w.ProfileCountMap.TotalCount() == 0 && w.MinVRAMCount == 0 && len(w.Alternatives) == 0
+}
@@ -80,3 +80,60 @@ func TestJsonLoad(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, res.Count(), 6)
 }
+
+func TestWorkloadResourceRequestWithVRAM(t *testing.T) {
+	req := &WorkloadResourceRequest{}
+	err := req.Parse(resourcetypes.RawParams{
+		"prod_vram_map": VRAMMap{
+			"nvidia-a10": 1024,
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, req.Validate())
+	assert.Equal(t, 0, req.Count())
+	assert.False(t, req.Empty())
+
+	// a product can't be requested by both count and vram
+	req.ProdCountMap = ProdCountMap{"nvidia-a10": 1}
+	assert.Error(t, req.Validate())
+
+	req = &WorkloadResourceRequest{ProdVRAMMap: VRAMMap{"nvidia-a10": -512}}
+	assert.Error(t, req.Validate())
+	assert.Nil(t, req.ValidateProd())
+	req.MergeFromResource(&WorkloadResource{ProdVRAMMap: VRAMMap{"nvidia-a10": 1024}})
+	assert.Equal(t, VRAMMap{"nvidia-a10": 512}, req.ProdVRAMMap)
+}
+
+func TestWorkloadResourceRequestWithAlternatives(t *testing.T) {
+	req := &WorkloadResourceRequest{}
+	err := req.Parse(resourcetypes.RawParams{
+		"alternatives": []ProdCountMap{
+			{"nvidia-a100": 2},
+			{"nvidia-3090": 4},
+		},
+		"prod_vram_map": VRAMMap{"nvidia-a10": 1024},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, req.Validate())
+	assert.False(t, req.Empty())
+
+	reqs := req.Expand()
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, ProdCountMap{"nvidia-a100": 2}, reqs[0].ProdCountMap)
+	assert.Equal(t, ProdCountMap{"nvidia-3090": 4}, reqs[1].ProdCountMap)
+	assert.Nil(t, reqs[1].Alternatives)
+	assert.Equal(t, VRAMMap{"nvidia-a10": 1024}, reqs[1].ProdVRAMMap)
+	// the alternatives of origin are not changed
+	reqs[0].ProdCountMap["nvidia-a100"] = 1
+	assert.Equal(t, ProdCountMap{"nvidia-a100": 2}, req.Alternatives[0])
+
+	assert.Len(t, (&WorkloadResourceRequest{}).Expand(), 1)
+
+	req.ProdCountMap = ProdCountMap{"nvidia-a100": 1}
+	assert.Error(t, req.Validate())
+	req = &WorkloadResourceRequest{Alternatives: []ProdCountMap{{}}}
+	assert.Error(t, req.Validate())
+	req = &WorkloadResourceRequest{Alternatives: []ProdCountMap{{"nvidia-a100": -1}}}
+	assert.Error(t, req.Validate())
+	assert.Nil(t, req.ValidateProd())
+}
@@ -0,0 +1,104 @@
+package gpu
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/projecteru2/core/utils"
+	"github.com/yuyang0/resource-gpu/gpu/store"
+	gputypes "github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+// WatchNodeResource sends the changes of the resource of all nodes,
+// the channel is closed when ctx is done or the watch fails, e.g. the receiver lags too far behind.
+func (p Plugin) WatchNodeResource(ctx context.Context) <-chan *gputypes.NodeEvent {
+	ch := make(chan *gputypes.NodeEvent)
+	events := p.store.Watch(ctx, nodeResourceInfoPrefix)
+	go func() {
+		defer close(ch)
+		for event := range events {
+			nodeEvents, err := p.nodeEventsOf(event)
+			if err != nil {
+				log.WithFunc("resource.gpu.WatchNodeResource").WithField("key", event.Key).Error(ctx, err, "invalid node resource info")
+				continue
+			}
+			for _, nodeEvent := range nodeEvents {
+				select {
+				case ch <- nodeEvent:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// nodeEventsOf converts the change of key to node events,
+// both capacity-changed and usage-changed are sent if both of them are changed.
+func (p Plugin) nodeEventsOf(event *store.Event) ([]*gputypes.NodeEvent, error) {
+	nodename := utils.Tail(event.Key)
+	now := time.Now()
+
+	var before, after *gputypes.NodeResourceInfo
+	var err error
+	if event.PrevValue != nil {
+		if before, err = p.unmarshalNodeResourceInfo(event.PrevValue); err != nil {
+			return nil, err
+		}
+	}
+	if event.Type == store.EventDelete {
+		if before == nil {
+			return nil, nil
+		}
+		return []*gputypes.NodeEvent{{
+			Type:     gputypes.EventNodeRemoved,
+			Nodename: nodename,
+			Time:     now,
+			Capacity: before.Capacity,
+			Usage:    before.Usage,
+		}}, nil
+	}
+
+	if after, err = p.unmarshalNodeResourceInfo(event.Value); err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return []*gputypes.NodeEvent{{
+			Type:     gputypes.EventNodeAdded,
+			Nodename: nodename,
+			Time:     now,
+			Capacity: after.Capacity,
+			Usage:    after.Usage,
+		}}, nil
+	}
+
+	nodeEvents := []*gputypes.NodeEvent{}
+	if !reflect.DeepEqual(before.Capacity, after.Capacity) {
+		nodeEvents = append(nodeEvents, &gputypes.NodeEvent{
+			Type:     gputypes.EventCapacityChanged,
+			Nodename: nodename,
+			Time:     now,
+			Capacity: after.Capacity,
+			Delta:    prodCountDelta(before.Capacity, after.Capacity),
+		})
+	}
+	if !reflect.DeepEqual(before.Usage, after.Usage) {
+		nodeEvents = append(nodeEvents, &gputypes.NodeEvent{
+			Type:     gputypes.EventUsageChanged,
+			Nodename: nodename,
+			Time:     now,
+			Usage:    after.Usage,
+			Delta:    prodCountDelta(before.Usage, after.Usage),
+		})
+	}
+	return nodeEvents, nil
+}
+
+func prodCountDelta(before, after *gputypes.NodeResource) gputypes.ProdCountMap {
+	delta := after.ProdCountMap.DeepCopy()
+	delta.Sub(before.ProdCountMap)
+	return delta
+}
@@ -0,0 +1,61 @@
+package gpu
+
+import (
+	"context"
+	"testing"
+
+	plugintypes "github.com/projecteru2/core/resource/plugins/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuyang0/resource-gpu/gpu/types"
+)
+
+func TestWatchNodeResource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cm := initGPU(ctx, t)
+	ch := cm.WatchNodeResource(ctx)
+
+	node := "test-watch"
+	_, err := cm.AddNode(ctx, node, plugintypes.NodeResourceRequest{"gpu_map": generateGPUMap("nvidia-3070", 2, 0)}, nil)
+	assert.Nil(t, err)
+	event := <-ch
+	assert.Equal(t, types.EventNodeAdded, event.Type)
+	assert.Equal(t, node, event.Nodename)
+	assert.Equal(t, 2, event.Capacity.Count())
+
+	_, err = cm.SetNodeResourceUsage(ctx, node, nil, nil, []plugintypes.WorkloadResource{
+		{"prod_count_map": types.ProdCountMap{"nvidia-3070": 1}},
+	}, true, true)
+	assert.Nil(t, err)
+	event = <-ch
+	assert.Equal(t, types.EventUsageChanged, event.Type)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": 1}, event.Delta)
+	assert.Nil(t, event.Capacity)
+
+	_, err = cm.SetNodeResourceCapacity(ctx, node, plugintypes.NodeResourceRequest{
+		"gpu_map": generateGPUMap("nvidia-3090", 1, 2),
+	}, nil, true, true)
+	assert.Nil(t, err)
+	event = <-ch
+	assert.Equal(t, types.EventCapacityChanged, event.Type)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3090": 1}, event.Delta)
+
+	// capacity and usage are changed together
+	_, err = cm.SetNodeResourceInfo(ctx, node, plugintypes.NodeResource{}, plugintypes.NodeResource{})
+	assert.Nil(t, err)
+	event = <-ch
+	assert.Equal(t, types.EventCapacityChanged, event.Type)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": -2, "nvidia-3090": -1}, event.Delta)
+	event = <-ch
+	assert.Equal(t, types.EventUsageChanged, event.Type)
+	assert.Equal(t, types.ProdCountMap{"nvidia-3070": -1}, event.Delta)
+
+	_, err = cm.RemoveNode(ctx, node)
+	assert.Nil(t, err)
+	event = <-ch
+	assert.Equal(t, types.EventNodeRemoved, event.Type)
+	assert.Equal(t, node, event.Nodename)
+
+	cancel()
+	for range ch {
+	}
+}